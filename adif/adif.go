@@ -0,0 +1,206 @@
+// Package adif reads logs in the Amateur Data Interchange Format, both .adi and .adx (https://adif.org/)
+package adif
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Longer than any field a log has a use for, but small enough to allocate
+const maxFieldLength = 1024 * 1024
+
+var ErrSyntax = errors.New("invalid ADIF")
+
+// Record is one QSO, by upper-case field name
+type Record map[string]string
+
+// ReadFile reads an .adi or .adx file, telling them apart by the extension
+func ReadFile(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".adx") {
+		return ParseADX(file)
+	}
+	return ParseADI(file)
+}
+
+// ParseADI reads the tag-based format, skipping the header if there is one
+func ParseADI(reader io.Reader) ([]Record, error) {
+	var (
+		r       = bufio.NewReader(reader)
+		records []Record
+		record  = make(Record)
+	)
+
+	// A header is any text before the first tag, up to <EOH>
+	start, err := r.Peek(1)
+	header := err == nil && start[0] != '<'
+
+	for {
+		// Anything outside of tags is a comment
+		if _, err := r.ReadString('<'); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		tag, err := r.ReadString('>')
+		if err != nil {
+			return nil, fmt.Errorf("%w: unterminated tag %q", ErrSyntax, tag)
+		}
+		tag = strings.TrimSuffix(tag, ">")
+
+		name, length, err := parseTag(tag)
+		if err != nil {
+			return nil, err
+		}
+
+		switch name {
+		case "EOH":
+			header = false
+			record = make(Record)
+			continue
+		case "EOR":
+			if len(record) > 0 {
+				records = append(records, record)
+			}
+			record = make(Record)
+			continue
+		}
+
+		data := make([]byte, length)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("%w: field %s is cut short", ErrSyntax, name)
+		}
+		if !header {
+			record[name] = string(data)
+		}
+	}
+
+	return records, nil
+}
+
+// <NAME:LENGTH> or <NAME:LENGTH:TYPE>, or just <NAME> for EOH and EOR
+func parseTag(tag string) (string, int, error) {
+	parts := strings.Split(tag, ":")
+	name := strings.ToUpper(strings.TrimSpace(parts[0]))
+	if name == "" {
+		return "", 0, fmt.Errorf("%w: empty tag", ErrSyntax)
+	}
+	if len(parts) == 1 {
+		return name, 0, nil
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || length < 0 || length > maxFieldLength {
+		return "", 0, fmt.Errorf("%w: length in tag <%s>", ErrSyntax, tag)
+	}
+
+	return name, length, nil
+}
+
+// ParseADX reads the XML format; application-defined fields are named APP_PROGRAMID_FIELDNAME like in .adi
+func ParseADX(reader io.Reader) ([]Record, error) {
+	var (
+		decoder  = xml.NewDecoder(reader)
+		records  []Record
+		record   Record
+		field    string
+		data     strings.Builder
+		inHeader = false
+	)
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSyntax, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := strings.ToUpper(t.Name.Local)
+			switch {
+			case name == "HEADER":
+				inHeader = true
+			case name == "RECORD":
+				record = make(Record)
+			case record != nil && !inHeader:
+				field = name
+				if name == "APP" {
+					field = "APP_" + attribute(t, "PROGRAMID") + "_" + attribute(t, "FIELDNAME")
+				} else if name == "USERDEF" {
+					field = attribute(t, "FIELDNAME")
+				}
+				data.Reset()
+			}
+		case xml.CharData:
+			if field != "" {
+				data.Write(t)
+			}
+		case xml.EndElement:
+			name := strings.ToUpper(t.Name.Local)
+			switch {
+			case name == "HEADER":
+				inHeader = false
+			case name == "RECORD":
+				if len(record) > 0 {
+					records = append(records, record)
+				}
+				record = nil
+			case field != "":
+				record[field] = data.String()
+				field = ""
+			}
+		}
+	}
+
+	return records, nil
+}
+
+func attribute(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if strings.EqualFold(attr.Name.Local, name) {
+			return strings.ToUpper(attr.Value)
+		}
+	}
+	return ""
+}
+
+// Frequency returns FREQ, which is in MHz, in Hz
+func (r Record) Frequency() (uint64, bool) {
+	mhz, err := strconv.ParseFloat(strings.TrimSpace(r["FREQ"]), 64)
+	if err != nil || mhz <= 0 {
+		return 0, false
+	}
+	return uint64(math.Round(mhz * 1e6)), true
+}
+
+// Time returns the start of the QSO from QSO_DATE and TIME_ON, which are in UTC
+func (r Record) Time() (time.Time, bool) {
+	date, clock := strings.TrimSpace(r["QSO_DATE"]), strings.TrimSpace(r["TIME_ON"])
+
+	layout := "20060102 1504"
+	if len(clock) == 6 {
+		layout = "20060102 150405"
+	}
+
+	t, err := time.Parse(layout, date+" "+clock)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,80 @@
+package adif
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadFile(t *testing.T) {
+	for _, path := range []string{"testdata/log.adi", "testdata/log.adx"} {
+		t.Run(path, func(t *testing.T) {
+			records, err := ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) < 2 {
+				t.Fatalf("expected at least 2 records, got %d", len(records))
+			}
+
+			first := records[0]
+			if first["CALL"] != "K1ABC" || first["GRIDSQUARE"] != "FN42" || first["MODE"] != "FT8" || first["RST_RCVD"] != "-15" {
+				t.Errorf("unexpected record %+v", first)
+			}
+			if frequency, ok := first.Frequency(); !ok || frequency != 14075123 {
+				t.Errorf("unexpected frequency %d", frequency)
+			}
+			if when, ok := first.Time(); !ok || !when.Equal(time.Date(2022, 12, 1, 12, 0, 15, 0, time.UTC)) {
+				t.Errorf("unexpected time %v", when)
+			}
+
+			second := records[1]
+			if second["CALL"] != "OH2ABC" || second["MODE"] != "MFSK" || second["SUBMODE"] != "FT4" {
+				t.Errorf("unexpected record %+v", second)
+			}
+			if when, ok := second.Time(); !ok || !when.Equal(time.Date(2022, 12, 1, 12, 15, 0, 0, time.UTC)) {
+				t.Errorf("unexpected time %v", when)
+			}
+		})
+	}
+}
+
+func TestParseADI(t *testing.T) {
+	records, err := ReadFile("testdata/log.adi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Header fields don't leak into records, and data can contain anything
+	if len(records) != 5 || records[0]["PROGRAMID"] != "" || records[1]["COMMENT"] != "5W <EOR> inside" {
+		t.Errorf("unexpected records %+v", records)
+	}
+
+	// No header at all
+	records, err = ParseADI(strings.NewReader("<CALL:5>K1ABC<EOR>"))
+	if err != nil || len(records) != 1 || records[0]["CALL"] != "K1ABC" {
+		t.Errorf("unexpected records %+v, %v", records, err)
+	}
+
+	for _, adi := range []string{"<CALL:5>K1A", "<CALL:x>K1ABC<EOR>", "<CALL:5", "<CALL:9223372036854775807>K1ABC<EOR>", "<CALL:2097152>K1ABC<EOR>"} {
+		if _, err = ParseADI(strings.NewReader(adi)); !errors.Is(err, ErrSyntax) {
+			t.Errorf("%q: expected %v, got %v", adi, ErrSyntax, err)
+		}
+	}
+}
+
+func TestParseADX(t *testing.T) {
+	records, err := ReadFile("testdata/log.adx")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 || records[0]["PROGRAMID"] != "" || records[0]["APP_MONOLOG_COMPRESSION"] != "off" || records[0]["EPC"] != "32123" {
+		t.Errorf("unexpected records %+v", records)
+	}
+
+	if _, err = ParseADX(strings.NewReader("<ADX><RECORDS><RECORD><CALL>K1ABC</RECORD>")); !errors.Is(err, ErrSyntax) {
+		t.Errorf("expected %v, got %v", ErrSyntax, err)
+	}
+}
@@ -0,0 +1,143 @@
+package adif
+
+import (
+	"strings"
+)
+
+// Modes has the MODE enumeration of ADIF 3.1.4, each with its SUBMODEs
+var Modes = map[string][]string{
+	"AM":           nil,
+	"ARDOP":        nil,
+	"ATV":          nil,
+	"CHIP":         {"CHIP64", "CHIP128"},
+	"CLO":          nil,
+	"CONTESTI":     nil,
+	"CW":           {"PCW"},
+	"DIGITALVOICE": {"C4FM", "DMR", "DSTAR", "FREEDV", "M17"},
+	"DOMINO":       {"DOM-M", "DOM4", "DOM5", "DOM8", "DOM11", "DOM16", "DOM22", "DOM44", "DOM88", "DOMINOEX", "DOMINOF"},
+	"DYNAMIC":      {"VARA HF", "VARA SATELLITE", "VARA FM 1200", "VARA FM 9600"},
+	"FAX":          nil,
+	"FM":           nil,
+	"FSK441":       nil,
+	"FT8":          nil,
+	"HELL":         {"FMHELL", "FSKHELL", "HELL80", "HELLX5", "HELLX9", "HFSK", "PSKHELL", "SLOWHELL"},
+	"ISCAT":        {"ISCAT-A", "ISCAT-B"},
+	"JT4":          {"JT4A", "JT4B", "JT4C", "JT4D", "JT4E", "JT4F", "JT4G"},
+	"JT6M":         nil,
+	"JT9":          {"JT9-1", "JT9-2", "JT9-5", "JT9-10", "JT9-30", "JT9A", "JT9B", "JT9C", "JT9D", "JT9E", "JT9E FAST", "JT9F", "JT9F FAST", "JT9G", "JT9G FAST", "JT9H", "JT9H FAST"},
+	"JT44":         nil,
+	"JT65":         {"JT65A", "JT65B", "JT65B2", "JT65C", "JT65C2"},
+	"MFSK":         {"FSQCALL", "FST4", "FST4W", "FT4", "JS8", "JTMS", "MFSK4", "MFSK8", "MFSK11", "MFSK16", "MFSK22", "MFSK31", "MFSK32", "MFSK64", "MFSK64L", "MFSK128", "MFSK128L", "Q65"},
+	"MSK144":       nil,
+	"MT63":         nil,
+	"OLIVIA":       {"OLIVIA 4/125", "OLIVIA 4/250", "OLIVIA 8/250", "OLIVIA 8/500", "OLIVIA 16/500", "OLIVIA 16/1000", "OLIVIA 32/1000"},
+	"OPERA":        {"OPERA-BEACON", "OPERA-QSO"},
+	"PAC":          {"PAC2", "PAC3", "PAC4"},
+	"PAX":          {"PAX2"},
+	"PKT":          nil,
+	"PSK": {"8PSK125", "8PSK125F", "8PSK125FL", "8PSK250", "8PSK250F", "8PSK250FL", "8PSK500", "8PSK500F", "8PSK1000", "8PSK1000F", "8PSK1200F",
+		"FSK31", "PSK10", "PSK31", "PSK63", "PSK63F", "PSK63RC4", "PSK63RC5", "PSK63RC10", "PSK63RC20", "PSK63RC32", "PSK125", "PSK125C12",
+		"PSK125R", "PSK125RC10", "PSK125RC12", "PSK125RC16", "PSK125RC4", "PSK125RC5", "PSK250", "PSK250C6", "PSK250R", "PSK250RC2",
+		"PSK250RC3", "PSK250RC5", "PSK250RC6", "PSK250RC7", "PSK500", "PSK500C2", "PSK500C4", "PSK500R", "PSK500RC2", "PSK500RC3",
+		"PSK500RC4", "PSK800C2", "PSK800RC2", "PSK1000", "PSK1000C2", "PSK1000R", "PSK1000RC2", "PSKAM10", "PSKAM31", "PSKAM50",
+		"PSKFEC31", "QPSK31", "QPSK63", "QPSK125", "QPSK250", "QPSK500", "SIM31"},
+	"PSK2K":  nil,
+	"Q15":    nil,
+	"QRA64":  {"QRA64A", "QRA64B", "QRA64C", "QRA64D", "QRA64E"},
+	"ROS":    {"ROS-EME", "ROS-HF", "ROS-MF"},
+	"RTTY":   {"ASCI"},
+	"RTTYM":  nil,
+	"SSB":    {"LSB", "USB"},
+	"SSTV":   nil,
+	"T10":    nil,
+	"THOR":   {"THOR-M", "THOR4", "THOR5", "THOR8", "THOR11", "THOR16", "THOR22", "THOR25X4", "THOR50X1", "THOR50X2", "THOR100"},
+	"THRB":   {"THRBX", "THRBX1", "THRBX2", "THRBX4", "THROB1", "THROB2", "THROB4"},
+	"TOR":    {"AMTORFEC", "GTOR", "NAVTEX", "SITORB"},
+	"V4":     nil,
+	"VOI":    nil,
+	"WINMOR": nil,
+	"WSPR":   nil,
+}
+
+// ModeAliases are what decoders and rigs call some modes, by the ADIF MODE or SUBMODE they stand for
+var ModeAliases = map[string]string{
+	"JS8CALL":   "JS8",
+	"FT-8":      "FT8",
+	"FT-4":      "FT4",
+	"BPSK31":    "PSK31",
+	"BPSK63":    "PSK63",
+	"BPSK125":   "PSK125",
+	"BPSK250":   "PSK250",
+	"BPSK500":   "PSK500",
+	"BPSK1000":  "PSK1000",
+	"CONTESTIA": "CONTESTI",
+	"D-STAR":    "DSTAR",
+	"YSF":       "C4FM",
+	"VARA":      "VARA HF",
+	"A1A":       "CW",
+	"CWR":       "CW",
+	"RTTYR":     "RTTY",
+	"PKTUSB":    "USB",
+	"PKTLSB":    "LSB",
+	"PKTFM":     "FM",
+	"WFM":       "FM",
+
+	// fldigi's names for the Olivia submodes, and for the same variants of Contestia, which has none
+	"OLIVIA-4-125":      "OLIVIA 4/125",
+	"OLIVIA-4-250":      "OLIVIA 4/250",
+	"OLIVIA-8-250":      "OLIVIA 8/250",
+	"OLIVIA-8-500":      "OLIVIA 8/500",
+	"OLIVIA-16-500":     "OLIVIA 16/500",
+	"OLIVIA-16-1000":    "OLIVIA 16/1000",
+	"OLIVIA-32-1000":    "OLIVIA 32/1000",
+	"CONTESTIA-4-125":   "CONTESTI",
+	"CONTESTIA-4-250":   "CONTESTI",
+	"CONTESTIA-8-250":   "CONTESTI",
+	"CONTESTIA-8-500":   "CONTESTI",
+	"CONTESTIA-16-500":  "CONTESTI",
+	"CONTESTIA-16-1000": "CONTESTI",
+	"CONTESTIA-32-1000": "CONTESTI",
+}
+
+// Submode to mode, built from Modes
+var submodes = func() map[string]string {
+	submodes := make(map[string]string)
+	for mode, names := range Modes {
+		for _, submode := range names {
+			submodes[submode] = mode
+		}
+	}
+	return submodes
+}()
+
+// LookupMode finds name, which is an ADIF MODE or SUBMODE or an alias of one in any case, and returns the MODE it
+// is or belongs to, and the SUBMODE if it is one; "js8call" gives "MFSK" and "JS8"
+func LookupMode(name string) (mode string, submode string, ok bool) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if alias, found := ModeAliases[name]; found {
+		name = alias
+	}
+
+	if _, found := Modes[name]; found {
+		return name, "", true
+	}
+	if mode, found := submodes[name]; found {
+		return mode, name, true
+	}
+	return "", "", false
+}
+
+// CanonicalMode returns the most specific ADIF name for name, the SUBMODE if it is one, or false if it's unknown
+func CanonicalMode(name string) (string, bool) {
+	mode, submode, ok := LookupMode(name)
+	if submode != "" {
+		return submode, ok
+	}
+	return mode, ok
+}
+
+// ParentMode returns the MODE a SUBMODE belongs to, such as "MFSK" for "FT4"; a MODE belongs to itself
+func ParentMode(name string) (string, bool) {
+	mode, _, ok := LookupMode(name)
+	return mode, ok
+}
@@ -0,0 +1,54 @@
+package adif
+
+import "testing"
+
+func TestLookupMode(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		mode      string
+		submode   string
+		canonical string
+		ok        bool
+	}{
+		{"FT8", "FT8", "", "FT8", true},
+		{"ft4", "MFSK", "FT4", "FT4", true},
+		{"JS8", "MFSK", "JS8", "JS8", true},
+		{"JS8Call", "MFSK", "JS8", "JS8", true},
+		{"BPSK31", "PSK", "PSK31", "PSK31", true},
+		{"olivia 8/500", "OLIVIA", "OLIVIA 8/500", "OLIVIA 8/500", true},
+		{" CW ", "CW", "", "CW", true},
+		{"PKTUSB", "SSB", "USB", "USB", true},
+		{"CONTESTIA", "CONTESTI", "", "CONTESTI", true},
+		{"OLIVIA-16-500", "OLIVIA", "OLIVIA 16/500", "OLIVIA 16/500", true},
+		{"Contestia-8-500", "CONTESTI", "", "CONTESTI", true},
+		{"FT9", "", "", "", false},
+		{"", "", "", "", false},
+	} {
+		mode, submode, ok := LookupMode(tt.name)
+		if mode != tt.mode || submode != tt.submode || ok != tt.ok {
+			t.Errorf("%q: expected %q, %q and %v, got %q, %q and %v", tt.name, tt.mode, tt.submode, tt.ok, mode, submode, ok)
+		}
+		if canonical, _ := CanonicalMode(tt.name); canonical != tt.canonical {
+			t.Errorf("%q: expected canonical %q, got %q", tt.name, tt.canonical, canonical)
+		}
+		if parent, _ := ParentMode(tt.name); parent != tt.mode {
+			t.Errorf("%q: expected parent %q, got %q", tt.name, tt.mode, parent)
+		}
+	}
+}
+
+// Aliases must lead somewhere, and no name can be both a MODE and a SUBMODE
+func TestModes(t *testing.T) {
+	for alias, name := range ModeAliases {
+		if _, _, ok := LookupMode(name); !ok {
+			t.Errorf("alias %q stands for unknown %q", alias, name)
+		}
+	}
+	for _, names := range Modes {
+		for _, submode := range names {
+			if _, found := Modes[submode]; found {
+				t.Errorf("%q is both a MODE and a SUBMODE", submode)
+			}
+		}
+	}
+}
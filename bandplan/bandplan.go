@@ -0,0 +1,204 @@
+// Package bandplan knows the amateur bands of the three IARU regions, for telling which band a frequency is on
+package bandplan
+
+import (
+	"sort"
+)
+
+const (
+	Region_Any = iota // Any band in any region, so every frequency some amateur may use is in band
+	Region_1          // Europe, Africa, the Middle East and northern Asia
+	Region_2          // The Americas
+	Region_3          // The rest of Asia and the Pacific
+)
+
+const (
+	OutOfBand    = "oob"        // The name for frequencies outside every band, such as for metric labels
+	MinFrequency = 8300         // Hz; nothing lower is allocated to anyone...
+	MaxFrequency = 275000 * MHz // ...nor anything higher
+)
+
+// Band is an amateur allocation, with inclusive edges in Hz
+type Band struct {
+	Name  string
+	Lower uint64
+	Upper uint64
+}
+
+// Contains tells whether frequency is within the band's edges
+func (b Band) Contains(frequency uint64) bool {
+	return frequency >= b.Lower && frequency <= b.Upper
+}
+
+// Plan is the bands of a region, lowest first
+type Plan []Band
+
+const (
+	kHz = 1000
+	MHz = 1000 * kHz
+)
+
+// The bands common to every region
+var common = Plan{
+	{"2200m", 135700, 137800},
+	{"630m", 472 * kHz, 479 * kHz},
+	{"30m", 10100 * kHz, 10150 * kHz},
+	{"20m", 14000 * kHz, 14350 * kHz},
+	{"17m", 18068 * kHz, 18168 * kHz},
+	{"15m", 21000 * kHz, 21450 * kHz},
+	{"12m", 24890 * kHz, 24990 * kHz},
+	{"10m", 28000 * kHz, 29700 * kHz},
+	{"23cm", 1240 * MHz, 1300 * MHz},
+	{"13cm", 2300 * MHz, 2450 * MHz},
+	{"3cm", 10000 * MHz, 10500 * MHz},
+	{"1.2cm", 24000 * MHz, 24250 * MHz},
+	{"6mm", 47000 * MHz, 47200 * MHz},
+	{"4mm", 75500 * MHz, 81000 * MHz},
+	{"2.5mm", 122250 * MHz, 123000 * MHz},
+	{"2mm", 134000 * MHz, 141000 * MHz},
+	{"1mm", 241000 * MHz, 250000 * MHz},
+}
+
+var (
+	Region1 = merge(common, Plan{
+		{"160m", 1810 * kHz, 2000 * kHz},
+		{"80m", 3500 * kHz, 3800 * kHz},
+		{"60m", 5351500, 5366500},
+		{"40m", 7000 * kHz, 7200 * kHz},
+		{"6m", 50 * MHz, 52 * MHz},
+		{"4m", 70 * MHz, 70500 * kHz},
+		{"2m", 144 * MHz, 146 * MHz},
+		{"70cm", 430 * MHz, 440 * MHz},
+		{"9cm", 3400 * MHz, 3475 * MHz},
+		{"6cm", 5650 * MHz, 5850 * MHz},
+	})
+	Region2 = merge(common, Plan{
+		{"160m", 1800 * kHz, 2000 * kHz},
+		{"80m", 3500 * kHz, 4000 * kHz},
+		{"60m", 5330500, 5406500},
+		{"40m", 7000 * kHz, 7300 * kHz},
+		{"6m", 50 * MHz, 54 * MHz},
+		{"2m", 144 * MHz, 148 * MHz},
+		{"1.25m", 219 * MHz, 225 * MHz},
+		{"70cm", 420 * MHz, 450 * MHz},
+		{"33cm", 902 * MHz, 928 * MHz},
+		{"9cm", 3300 * MHz, 3500 * MHz},
+		{"6cm", 5650 * MHz, 5925 * MHz},
+	})
+	Region3 = merge(common, Plan{
+		{"160m", 1800 * kHz, 2000 * kHz},
+		{"80m", 3500 * kHz, 3900 * kHz},
+		{"60m", 5351500, 5366500},
+		{"40m", 7000 * kHz, 7300 * kHz},
+		{"6m", 50 * MHz, 54 * MHz},
+		{"2m", 144 * MHz, 148 * MHz},
+		{"70cm", 430 * MHz, 440 * MHz},
+		{"9cm", 3300 * MHz, 3500 * MHz},
+		{"6cm", 5650 * MHz, 5850 * MHz},
+	})
+	// Each band at its widest in any region
+	Worldwide = merge(Region1, Region2, Region3)
+)
+
+// ForRegion returns the plan of one of Region_*
+func ForRegion(region int) Plan {
+	switch region {
+	case Region_1:
+		return Region1
+	case Region_2:
+		return Region2
+	case Region_3:
+		return Region3
+	}
+	return Worldwide
+}
+
+// Combine plans, widening bands of the same name to cover all of them
+func merge(plans ...Plan) Plan {
+	var (
+		merged Plan
+		index  = make(map[string]int)
+	)
+	for _, plan := range plans {
+		for _, band := range plan {
+			i, found := index[band.Name]
+			if !found {
+				index[band.Name] = len(merged)
+				merged = append(merged, band)
+				continue
+			}
+			if band.Lower < merged[i].Lower {
+				merged[i].Lower = band.Lower
+			}
+			if band.Upper > merged[i].Upper {
+				merged[i].Upper = band.Upper
+			}
+		}
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Lower < merged[j].Lower
+	})
+	return merged
+}
+
+// Band returns the band frequency is on, or false if it's out of band
+func (p Plan) Band(frequency uint64) (Band, bool) {
+	for _, band := range p {
+		if band.Contains(frequency) {
+			return band, true
+		}
+	}
+	return Band{}, false
+}
+
+// Name returns the name of the band frequency is on, such as "20m", or OutOfBand
+func (p Plan) Name(frequency uint64) string {
+	if band, ok := p.Band(frequency); ok {
+		return band.Name
+	}
+	return OutOfBand
+}
+
+// Contains tells whether frequency is on any band of the plan
+func (p Plan) Contains(frequency uint64) bool {
+	_, ok := p.Band(frequency)
+	return ok
+}
+
+// Only returns a filter for frequencies on the named bands
+func (p Plan) Only(names ...string) func(frequency uint64) bool {
+	return func(frequency uint64) bool {
+		band, ok := p.Band(frequency)
+		if !ok {
+			return false
+		}
+		for _, name := range names {
+			if band.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// From returns a filter for frequencies on the named band and the bands above it, as in "6m and up";
+// a name not in the plan lets nothing through
+func (p Plan) From(name string) func(frequency uint64) bool {
+	var lower uint64
+	for _, band := range p {
+		if band.Name == name {
+			lower = band.Lower
+		}
+	}
+
+	return func(frequency uint64) bool {
+		band, ok := p.Band(frequency)
+		return ok && lower != 0 && band.Lower >= lower
+	}
+}
+
+// Plausible tells whether frequency could be a radio frequency anyone transmits on
+func Plausible(frequency uint64) bool {
+	return frequency >= MinFrequency && frequency <= MaxFrequency
+}
@@ -0,0 +1,127 @@
+package bandplan
+
+import (
+	"testing"
+)
+
+func TestName(t *testing.T) {
+	for _, tt := range []struct {
+		plan      Plan
+		frequency uint64
+		want      string
+	}{
+		{Worldwide, 136000, "2200m"},
+		{Worldwide, 1840000, "160m"},
+		{Region1, 1805000, OutOfBand},
+		{Region2, 1805000, "160m"},
+		{Region1, 3573000, "80m"},
+		{Region1, 3900000, OutOfBand},
+		{Region2, 3900000, "80m"},
+		{Worldwide, 3900000, "80m"},
+		{Worldwide, 14074000, "20m"},
+		{Worldwide, 28074000, "10m"},
+		{Worldwide, 50313000, "6m"},
+		{Region1, 53000000, OutOfBand},
+		{Region3, 53000000, "6m"},
+		{Region1, 70154000, "4m"},
+		{Region2, 70154000, OutOfBand},
+		{Worldwide, 144174000, "2m"},
+		{Region2, 222100000, "1.25m"},
+		{Worldwide, 432174000, "70cm"},
+		{Region1, 915000000, OutOfBand},
+		{Region2, 915000000, "33cm"},
+		{Worldwide, 1296174000, "23cm"},
+		{Worldwide, 10368100000, "3cm"},
+		{Worldwide, 0, OutOfBand},
+		{Worldwide, 15000000, OutOfBand},
+	} {
+		if got := tt.plan.Name(tt.frequency); got != tt.want {
+			t.Errorf("%d: expected %q, got %q", tt.frequency, tt.want, got)
+		}
+		if got := tt.plan.Contains(tt.frequency); got != (tt.want != OutOfBand) {
+			t.Errorf("%d: expected contains to be %v", tt.frequency, tt.want != OutOfBand)
+		}
+	}
+}
+
+func TestForRegion(t *testing.T) {
+	for _, tt := range []struct {
+		region int
+		want   Plan
+	}{
+		{Region_Any, Worldwide},
+		{Region_1, Region1},
+		{Region_2, Region2},
+		{Region_3, Region3},
+	} {
+		if got := ForRegion(tt.region); len(got) != len(tt.want) || got[0] != tt.want[0] {
+			t.Errorf("region %d: expected %v, got %v", tt.region, tt.want, got)
+		}
+	}
+
+	// Worldwide has each band at its widest
+	if band, _ := Worldwide.Band(3500000); band.Lower != 3500000 || band.Upper != 4000000 {
+		t.Errorf("expected 80m to be 3500000-4000000, got %d-%d", band.Lower, band.Upper)
+	}
+	if band, _ := Worldwide.Band(1850000); band.Lower != 1800000 || band.Upper != 2000000 {
+		t.Errorf("expected 160m to be 1800000-2000000, got %d-%d", band.Lower, band.Upper)
+	}
+
+	for _, plan := range []Plan{Region1, Region2, Region3, Worldwide} {
+		for i := 1; i < len(plan); i++ {
+			if plan[i].Lower <= plan[i-1].Upper {
+				t.Errorf("expected %s to be above %s", plan[i].Name, plan[i-1].Name)
+			}
+		}
+	}
+}
+
+func TestFilters(t *testing.T) {
+	from6m := Worldwide.From("6m")
+	only := Worldwide.Only("20m", "40m")
+	nothing := Worldwide.From("11m")
+
+	for _, tt := range []struct {
+		frequency uint64
+		from6m    bool
+		only      bool
+	}{
+		{7074000, false, true},
+		{14074000, false, true},
+		{28074000, false, false},
+		{50313000, true, false},
+		{144174000, true, false},
+		{10368100000, true, false},
+		{60000000, false, false},
+	} {
+		if got := from6m(tt.frequency); got != tt.from6m {
+			t.Errorf("%d: expected from 6m to be %v, got %v", tt.frequency, tt.from6m, got)
+		}
+		if got := only(tt.frequency); got != tt.only {
+			t.Errorf("%d: expected only to be %v, got %v", tt.frequency, tt.only, got)
+		}
+		if nothing(tt.frequency) {
+			t.Errorf("%d: expected an unknown band to let nothing through", tt.frequency)
+		}
+	}
+}
+
+func TestPlausible(t *testing.T) {
+	for _, tt := range []struct {
+		frequency uint64
+		want      bool
+	}{
+		{0, false},
+		{1500, false},
+		{8300, true},
+		{14074000, true},
+		{10368100000, true},
+		{275000000000, true},
+		{275000000001, false},
+		{1 << 63, false},
+	} {
+		if got := Plausible(tt.frequency); got != tt.want {
+			t.Errorf("%d: expected %v, got %v", tt.frequency, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Package callsign validates amateur radio callsigns, including portable and prefixed forms like "DL/K1ABC/P"
+package callsign
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const MaxLength = 20 // Longer than any real callsign, even with a prefix and suffix
+
+// Well-known suffixes
+const (
+	Suffix_Portable           = "P"
+	Suffix_Mobile             = "M"
+	Suffix_MaritimeMobile     = "MM" // Not in any DXCC entity
+	Suffix_AeronauticalMobile = "AM" // Not in any DXCC entity either
+	Suffix_QRP                = "QRP"
+)
+
+var (
+	ErrCallsign = errors.New("invalid callsign")
+	ErrHashed   = errors.New("unresolved hashed callsign")
+)
+
+var (
+	// One to three characters of ITU prefix, a digit, and a suffix ending in a letter: "K1ABC", "OH2ABC", "3DA0RU",
+	// "E51ABC", "GB13COL"
+	basePattern = regexp.MustCompile(`^[A-Z0-9]{1,3}[0-9][A-Z0-9]{0,3}[A-Z]$`)
+	// What goes on either side of a slash: a country prefix such as "DL" or "KH6", or something like "P" or "4"
+	affixPattern = regexp.MustCompile(`^[A-Z0-9]{1,4}$`)
+)
+
+// Callsign is a callsign taken apart
+type Callsign struct {
+	Prefix string // Where the station is operating from, as in "DL/K1ABC"
+	Base   string // The callsign itself, as in "K1ABC"
+	Suffix string // Such as Suffix_Portable, or a call area as in "K1ABC/4"
+}
+
+// Parse takes a callsign apart, ignoring case and WSJT-X's angle brackets around hashed callsigns
+func Parse(callsign string) (*Callsign, error) {
+	s := strings.ToUpper(strings.TrimSpace(callsign))
+
+	// WSJT-X shows callsigns it only has a hash of in angle brackets, or just "<...>" when it can't tell
+	if strings.HasPrefix(s, "<") && strings.HasSuffix(s, ">") {
+		s = s[1 : len(s)-1]
+		if s == "..." || s == "" {
+			return nil, fmt.Errorf("%w: %q", ErrHashed, callsign)
+		}
+	}
+
+	if len(s) > MaxLength {
+		return nil, fmt.Errorf("%w: %q is longer than %d characters", ErrCallsign, callsign, MaxLength)
+	}
+
+	parts := strings.Split(s, "/")
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("%w: %q", ErrCallsign, callsign)
+		}
+	}
+
+	var c Callsign
+	switch len(parts) {
+	case 1:
+		c.Base = parts[0]
+	case 2:
+		// Either "DL/K1ABC" or "K1ABC/P"; when both halves look like a callsign, the longer one is
+		if basePattern.MatchString(parts[0]) && (!basePattern.MatchString(parts[1]) || len(parts[0]) >= len(parts[1])) {
+			c.Base, c.Suffix = parts[0], parts[1]
+		} else {
+			c.Prefix, c.Base = parts[0], parts[1]
+		}
+	case 3:
+		c.Prefix, c.Base, c.Suffix = parts[0], parts[1], parts[2]
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrCallsign, callsign)
+	}
+
+	if !basePattern.MatchString(c.Base) {
+		return nil, fmt.Errorf("%w: %q", ErrCallsign, callsign)
+	}
+	for _, affix := range []string{c.Prefix, c.Suffix} {
+		if affix != "" && !affixPattern.MatchString(affix) {
+			return nil, fmt.Errorf("%w: %q", ErrCallsign, callsign)
+		}
+	}
+
+	return &c, nil
+}
+
+// String puts the callsign back together, as in "DL/K1ABC/P"
+func (c *Callsign) String() string {
+	s := c.Base
+	if c.Prefix != "" {
+		s = c.Prefix + "/" + s
+	}
+	if c.Suffix != "" {
+		s = s + "/" + c.Suffix
+	}
+	return s
+}
+
+// Valid tells whether callsign looks like an amateur radio callsign
+func Valid(callsign string) bool {
+	_, err := Parse(callsign)
+	return err == nil
+}
+
+// Normalize returns callsign in upper case and without angle brackets, if it's valid
+func Normalize(callsign string) (string, error) {
+	c, err := Parse(callsign)
+	if err != nil {
+		return "", err
+	}
+	return c.String(), nil
+}
+
+// Base returns the callsign without prefix or suffix, such as "K1ABC" for "DL/K1ABC/P"
+func Base(callsign string) (string, error) {
+	c, err := Parse(callsign)
+	if err != nil {
+		return "", err
+	}
+	return c.Base, nil
+}
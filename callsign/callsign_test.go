@@ -0,0 +1,71 @@
+package callsign
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		callsign string
+		want     Callsign
+		err      error
+	}{
+		{"K1ABC", Callsign{Base: "K1ABC"}, nil},
+		{" oh2abc ", Callsign{Base: "OH2ABC"}, nil},
+		{"3DA0RU", Callsign{Base: "3DA0RU"}, nil},
+		{"GB13COL", Callsign{Base: "GB13COL"}, nil},
+		{"K1A", Callsign{Base: "K1A"}, nil},
+		{"K1ABC/P", Callsign{Base: "K1ABC", Suffix: Suffix_Portable}, nil},
+		{"K1ABC/MM", Callsign{Base: "K1ABC", Suffix: Suffix_MaritimeMobile}, nil},
+		{"K1ABC/AM", Callsign{Base: "K1ABC", Suffix: Suffix_AeronauticalMobile}, nil},
+		{"K1ABC/4", Callsign{Base: "K1ABC", Suffix: "4"}, nil},
+		{"K1ABC/VE3", Callsign{Base: "K1ABC", Suffix: "VE3"}, nil},
+		{"DL/K1ABC", Callsign{Prefix: "DL", Base: "K1ABC"}, nil},
+		{"KH6/K1ABC", Callsign{Prefix: "KH6", Base: "K1ABC"}, nil},
+		{"DL/K1ABC/P", Callsign{Prefix: "DL", Base: "K1ABC", Suffix: Suffix_Portable}, nil},
+		{"<PJ4/K1ABC>", Callsign{Prefix: "PJ4", Base: "K1ABC"}, nil},
+		{"<...>", Callsign{}, ErrHashed},
+		{"<>", Callsign{}, ErrHashed},
+		{"", Callsign{}, ErrCallsign},
+		{"CQ", Callsign{}, ErrCallsign},
+		{"RR73", Callsign{}, ErrCallsign},
+		{"K1ABC/", Callsign{}, ErrCallsign},
+		{"/K1ABC", Callsign{}, ErrCallsign},
+		{"DL/K1ABC/P/QRP", Callsign{}, ErrCallsign},
+		{"K1ABC/PORTABLE", Callsign{}, ErrCallsign},
+		{"K1-ABC", Callsign{}, ErrCallsign},
+		{"K1ABCDEFGHIJKLMNOPQRSTUVWXYZ", Callsign{}, ErrCallsign},
+	} {
+		got, err := Parse(tt.callsign)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%q: expected %v, got %v", tt.callsign, tt.err, err)
+			continue
+		}
+		if err == nil && *got != tt.want {
+			t.Errorf("%q: expected %+v, got %+v", tt.callsign, tt.want, *got)
+		}
+		if Valid(tt.callsign) != (tt.err == nil) {
+			t.Errorf("%q: expected valid to be %v", tt.callsign, tt.err == nil)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for _, tt := range []struct {
+		callsign string
+		want     string
+		base     string
+	}{
+		{"k1abc", "K1ABC", "K1ABC"},
+		{"dl/k1abc/p", "DL/K1ABC/P", "K1ABC"},
+		{"<W9XYZ/MM>", "W9XYZ/MM", "W9XYZ"},
+	} {
+		if got, err := Normalize(tt.callsign); got != tt.want || err != nil {
+			t.Errorf("%q: expected %q, got %q and %v", tt.callsign, tt.want, got, err)
+		}
+		if got, err := Base(tt.callsign); got != tt.base || err != nil {
+			t.Errorf("%q: expected base %q, got %q and %v", tt.callsign, tt.base, got, err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Command adifspot submits the QSOs in an ADIF log to PSK Reporter as spots from a call log
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/kahara/go-pskreporter-spot"
+	"github.com/kahara/go-pskreporter-spot/adif"
+	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultHostport = "report.pskreporter.info:4739"
+	DecoderSoftware = "adifspot v0"
+)
+
+var ErrIncomplete = errors.New("record lacks a required field")
+
+// Maps a QSO to a spot of the other station, as heard by us
+func spotFromRecord(record adif.Record) (*spot.Spot, error) {
+	callsign := strings.ToUpper(strings.TrimSpace(record["CALL"]))
+	if callsign == "" {
+		return nil, fmt.Errorf("%w: CALL", ErrIncomplete)
+	}
+	frequency, ok := record.Frequency()
+	if !ok {
+		return nil, fmt.Errorf("%w: FREQ", ErrIncomplete)
+	}
+	when, ok := record.Time()
+	if !ok {
+		return nil, fmt.Errorf("%w: QSO_DATE or TIME_ON", ErrIncomplete)
+	}
+
+	// SUBMODE is the more specific one, such as FT4 for MFSK
+	mode := strings.ToUpper(strings.TrimSpace(record["SUBMODE"]))
+	if mode == "" {
+		mode = strings.ToUpper(strings.TrimSpace(record["MODE"]))
+	}
+	if mode == "" {
+		return nil, fmt.Errorf("%w: MODE", ErrIncomplete)
+	}
+
+	return spot.NewSpot(callsign, strings.TrimSpace(record["GRIDSQUARE"]), frequency, snr(record["RST_RCVD"]), 0, mode, spot.InformationSource_CallLog, uint32(when.Unix())), nil
+}
+
+// Digital modes log a signed report in dB, like "-15"; anything else, such as "599", isn't an SNR
+func snr(report string) int8 {
+	report = strings.TrimSpace(report)
+	if !strings.HasPrefix(report, "-") && !strings.HasPrefix(report, "+") {
+		return 0
+	}
+
+	value, err := strconv.ParseInt(report, 10, 8)
+	if err != nil {
+		return 0
+	}
+	return int8(value)
+}
+
+// The same QSO, even if logged twice with different details
+type qso struct {
+	callsign  string
+	frequency uint64
+	mode      string
+	flowStart uint32
+}
+
+// Turn records into spots, skipping ones that can't be and ones that have been seen already
+func spotsFromRecords(records []adif.Record) []*spot.Spot {
+	var (
+		spots []*spot.Spot
+		seen  = make(map[qso]bool)
+	)
+
+	for i, record := range records {
+		s, err := spotFromRecord(record)
+		if err != nil {
+			log.Warn().Err(err).Int("record", i+1).Msg("Skipping record")
+			continue
+		}
+		key := qso{s.Sender().Callsign, s.Frequency(), s.Mode(), s.FlowStartSeconds()}
+		if seen[key] {
+			log.Debug().Int("record", i+1).Str("callsign", s.Sender().Callsign).Msg("Skipping duplicate record")
+			continue
+		}
+		seen[key] = true
+		spots = append(spots, s)
+	}
+
+	return spots
+}
+
+// The receiver is ourselves, which the log may say if not given on the command line
+func receiverFromRecords(records []adif.Record, callsign string, locator string) spot.Station {
+	for _, record := range records {
+		if callsign == "" {
+			callsign = strings.ToUpper(strings.TrimSpace(record["STATION_CALLSIGN"]))
+		}
+		if callsign == "" {
+			callsign = strings.ToUpper(strings.TrimSpace(record["OPERATOR"]))
+		}
+		if locator == "" {
+			locator = strings.TrimSpace(record["MY_GRIDSQUARE"])
+		}
+	}
+	return spot.Station{Callsign: callsign, Locator: locator}
+}
+
+func printSpots(w io.Writer, receiver spot.Station, spots []*spot.Spot) {
+	fmt.Fprintf(w, "receiver %s %s\n", receiver.Callsign, receiver.Locator)
+	for _, s := range spots {
+		fmt.Fprintf(w, "%d %s %s %d %s %d\n", s.FlowStartSeconds(), s.Sender().Callsign, s.Sender().Locator, s.Frequency(), s.Mode(), s.SNR())
+	}
+}
+
+func main() {
+	var (
+		hostport = flag.String("hostport", DefaultHostport, "PSK Reporter address")
+		callsign = flag.String("callsign", "", "receiver callsign, instead of the log's STATION_CALLSIGN")
+		locator  = flag.String("locator", "", "receiver locator, instead of the log's MY_GRIDSQUARE")
+		antenna  = flag.String("antenna", "", "receiver antenna information")
+		tcp      = flag.Bool("tcp", false, "send over TCP instead of UDP")
+		dryRun   = flag.Bool("dry-run", false, "print what would be sent instead of sending it")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] log.adi|log.adx\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	records, err := adif.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal().Err(err).Str("path", flag.Arg(0)).Msg("Could not read log")
+	}
+	receiver := receiverFromRecords(records, *callsign, *locator)
+	spots := spotsFromRecords(records)
+
+	if *dryRun {
+		printSpots(os.Stdout, receiver, spots)
+		return
+	}
+
+	config := spot.DefaultConfig()
+	config.Hostport = *hostport
+	config.Callsign = receiver.Callsign
+	config.Locator = receiver.Locator
+	config.AntennaInformation = *antenna
+	config.DecoderSoftware = DecoderSoftware
+	if *tcp {
+		config.Transport = spot.Transport_TCP
+	}
+
+	spotter, err := spot.NewSpotterFromConfig(config)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not create spotter")
+	}
+	if err = spotter.Start(context.Background()); err != nil {
+		log.Fatal().Err(err).Msg("Could not start spotter")
+	}
+	for _, s := range spots {
+		spotter.Feed(s)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), spot.ShutdownTimeout)
+	defer cancel()
+	dropped, err := spotter.Shutdown(ctx)
+	if err != nil || dropped > 0 {
+		log.Error().Err(err).Int("count", dropped).Msg("Some spots could not be submitted")
+	}
+	log.Info().Int("count", len(spots)-dropped).Str("hostport", *hostport).Msg("Submitted spots")
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"github.com/kahara/go-pskreporter-spot"
+	"github.com/kahara/go-pskreporter-spot/adif"
+	"testing"
+	"time"
+)
+
+func TestSpotsFromRecords(t *testing.T) {
+	records, err := adif.ReadFile("../../adif/testdata/log.adi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The repeated K1ABC QSO, and W1AW without a frequency, are skipped
+	var (
+		at = func(hour, minute, second int) uint32 {
+			return uint32(time.Date(2022, 12, 1, hour, minute, second, 0, time.UTC).Unix())
+		}
+		want = []*spot.Spot{
+			spot.NewSpot("K1ABC", "FN42", 14075123, -15, 0, "FT8", spot.InformationSource_CallLog, at(12, 0, 15)),
+			spot.NewSpot("OH2ABC", "", 7047500, 2, 0, "FT4", spot.InformationSource_CallLog, at(12, 15, 0)),
+			spot.NewSpot("W9XYZ", "", 14025000, 0, 0, "CW", spot.InformationSource_CallLog, at(12, 30, 0)),
+		}
+		spots = spotsFromRecords(records)
+	)
+	if len(spots) != len(want) {
+		t.Fatalf("expected %d spots, got %d", len(want), len(spots))
+	}
+	for i := range want {
+		if *spots[i] != *want[i] {
+			t.Errorf("spot %d: expected %+v, got %+v", i, *want[i], *spots[i])
+		}
+	}
+
+	receiver := receiverFromRecords(records, "", "")
+	if receiver != (spot.Station{Callsign: "N0CALL", Locator: "JJ00OG"}) {
+		t.Errorf("unexpected receiver %+v", receiver)
+	}
+	if receiver = receiverFromRecords(records, "N0CALL/P", ""); receiver.Callsign != "N0CALL/P" {
+		t.Errorf("unexpected receiver %+v", receiver)
+	}
+
+	var output bytes.Buffer
+	printSpots(&output, receiver, spots[:1])
+	if got := output.String(); got != "receiver N0CALL/P JJ00OG\n1669896015 K1ABC FN42 14075123 FT8 -15\n" {
+		t.Errorf("unexpected dry run output %q", got)
+	}
+}
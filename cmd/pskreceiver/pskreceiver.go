@@ -0,0 +1,187 @@
+// Command pskreceiver is a small stand-in for PSK Reporter's collector, storing the reports it receives in SQLite
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"github.com/kahara/go-pskreporter-spot"
+	"github.com/rs/zerolog/log"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultListen   = ":4739"
+	DefaultDatabase = "pskreceiver.db"
+	MaxDatagramSize = 65535
+	ExporterTimeout = time.Hour // Forget templates of UDP exporters that have been quiet for this long
+)
+
+// Templates, and the latest receiver record, are scoped to a UDP source address or a TCP connection
+type exporter struct {
+	decoder  *spot.Decoder
+	receiver *spot.Receiver
+	lastSeen time.Time
+}
+
+func newExporter() *exporter {
+	return &exporter{decoder: spot.NewDecoder()}
+}
+
+func (e *exporter) handle(store *Store, network string, remote string, datagram []byte) {
+	e.lastSeen = time.Now()
+
+	message, err := e.decoder.Decode(datagram)
+	if err != nil {
+		log.Warn().Err(err).Str("network", network).Str("remote", remote).Msg("Could not decode message")
+		return
+	}
+
+	// A message doesn't necessarily repeat the receiver record, so remember the latest one
+	if len(message.Receivers) > 0 {
+		e.receiver = message.Receivers[len(message.Receivers)-1]
+	}
+
+	if err = store.Save(e.receiver, message.Spots, e.lastSeen); err != nil {
+		log.Error().Err(err).Str("network", network).Str("remote", remote).Msg("Could not store reports")
+		return
+	}
+	log.Debug().Str("network", network).Str("remote", remote).Int("count", len(message.Spots)).Msg("Stored reports")
+}
+
+func serveUDP(conn *net.UDPConn, store *Store) {
+	var (
+		exporters = make(map[string]*exporter)
+		buffer    = make([]byte, MaxDatagramSize)
+		pruned    = time.Now()
+	)
+
+	for {
+		n, remote, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Error().Err(err).Msg("Could not read from UDP")
+			}
+			return
+		}
+
+		e := exporters[remote.String()]
+		if e == nil {
+			e = newExporter()
+			exporters[remote.String()] = e
+		}
+		e.handle(store, "udp", remote.String(), buffer[:n])
+
+		if time.Since(pruned) > ExporterTimeout {
+			for key, e := range exporters {
+				if time.Since(e.lastSeen) > ExporterTimeout {
+					delete(exporters, key)
+				}
+			}
+			pruned = time.Now()
+		}
+	}
+}
+
+func serveTCP(ctx context.Context, listener net.Listener, store *Store) {
+	var wait sync.WaitGroup
+	defer wait.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Error().Err(err).Msg("Could not accept TCP connection")
+			}
+			return
+		}
+
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			serveConn(ctx, conn, store)
+		}()
+	}
+}
+
+func serveConn(ctx context.Context, conn net.Conn, store *Store) {
+	var (
+		e      = newExporter()
+		remote = conn.RemoteAddr().String()
+		reader = bufio.NewReader(conn)
+		done   = make(chan struct{})
+	)
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		_ = conn.Close()
+	}()
+
+	log.Info().Str("remote", remote).Msg("Spotter connected")
+	for {
+		datagram, err := spot.ReadMessage(reader)
+		if err != nil {
+			log.Info().Err(err).Str("remote", remote).Msg("Spotter disconnected")
+			return
+		}
+		e.handle(store, "tcp", remote, datagram)
+	}
+}
+
+func main() {
+	var (
+		listen   = flag.String("listen", DefaultListen, "address to listen on, for both UDP and TCP")
+		database = flag.String("database", DefaultDatabase, "SQLite database file to store reports in")
+	)
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	store, err := OpenStore(*database)
+	if err != nil {
+		log.Fatal().Err(err).Str("database", *database).Msg("Could not open database")
+	}
+	defer store.Close()
+
+	udpAddr, err := net.ResolveUDPAddr("udp", *listen)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not resolve address")
+	}
+	udpConn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not listen on UDP")
+	}
+	tcpListener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not listen on TCP")
+	}
+
+	var wait sync.WaitGroup
+	wait.Add(2)
+	go func() {
+		defer wait.Done()
+		serveUDP(udpConn, store)
+	}()
+	go func() {
+		defer wait.Done()
+		serveTCP(ctx, tcpListener, store)
+	}()
+	log.Info().Str("listen", *listen).Str("database", *database).Msg("Receiving spots")
+
+	<-ctx.Done()
+	log.Info().Msg("Shutting down")
+	_ = udpConn.Close()
+	_ = tcpListener.Close()
+	wait.Wait()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"github.com/kahara/go-pskreporter-spot"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReceiver(t *testing.T) {
+	const SpotCount = 25
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), DefaultDatabase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go serveUDP(udpConn, store)
+	go serveTCP(ctx, tcpListener, store)
+	defer udpConn.Close()
+	defer tcpListener.Close()
+
+	flowStart := uint32(time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC).Unix())
+	for _, tt := range []struct {
+		transport int
+		hostport  string
+	}{
+		{spot.Transport_UDP, udpConn.LocalAddr().String()},
+		{spot.Transport_TCP, tcpListener.Addr().String()},
+	} {
+		spotter := spot.NewSpotter(tt.hostport, "N0CALL", "JJ00OG", "Dipole", "fakespot v0", "", spot.SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, nil, spot.WithTransport(tt.transport))
+		for i := 0; i < SpotCount; i++ {
+			spotter.Feed(spot.NewSpot("N1CALL", "II00OG", uint64(50313650+i), -3, 2, "FT8", 1, flowStart))
+		}
+		spotter.Close()
+	}
+
+	var count int
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if err = store.db.QueryRow("SELECT COUNT(*) FROM report;").Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count == 2*SpotCount {
+			break
+		}
+	}
+	if count != 2*SpotCount {
+		t.Fatalf("expected %d reports, got %d", 2*SpotCount, count)
+	}
+
+	var (
+		when                                                      time.Time
+		senderCallsign, receiverCallsign, mode, antenna, software string
+		identifier                                                sql.NullString
+		frequency                                                 uint64
+		snr                                                       int8
+	)
+	err = store.db.QueryRow("SELECT time, sender_callsign, receiver_callsign, mode, antenna_information, decoder_software, persistent_identifier, frequency, snr FROM report ORDER BY frequency LIMIT 1;").
+		Scan(&when, &senderCallsign, &receiverCallsign, &mode, &antenna, &software, &identifier, &frequency, &snr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !when.Equal(time.Unix(int64(flowStart), 0)) || senderCallsign != "N1CALL" || receiverCallsign != "N0CALL" || mode != "FT8" || antenna != "Dipole" || software != "fakespot v0" || !identifier.Valid || frequency != 50313650 || snr != -3 {
+		t.Errorf("unexpected report %v %s %s %s %s %s %v %d %d", when, senderCallsign, receiverCallsign, mode, antenna, software, identifier, frequency, snr)
+	}
+}
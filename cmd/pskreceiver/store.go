@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql"
+	"github.com/kahara/go-pskreporter-spot"
+	_ "github.com/mattn/go-sqlite3"
+	"time"
+)
+
+// Same columns as the report table the integration test reads from
+const schema = `
+CREATE TABLE IF NOT EXISTS report (
+	time                  TIMESTAMP NOT NULL,
+	sender_callsign       TEXT,
+	receiver_callsign     TEXT,
+	sender_locator        TEXT,
+	receiver_locator      TEXT,
+	frequency             INTEGER,
+	snr                   INTEGER,
+	imd                   INTEGER,
+	decoder_software      TEXT,
+	antenna_information   TEXT,
+	mode                  TEXT,
+	information_source    INTEGER,
+	persistent_identifier TEXT
+);
+CREATE INDEX IF NOT EXISTS report_time ON report (time);
+`
+
+const insertReport = `
+INSERT INTO report (time, sender_callsign, receiver_callsign, sender_locator, receiver_locator, frequency, snr, imd, decoder_software, antenna_information, mode, information_source, persistent_identifier)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+`
+
+type Store struct {
+	db *sql.DB
+}
+
+func OpenStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only has one writer at a time anyway
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.Exec(schema); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Save writes a report for every spot, each joined with the receiver that sent it, in one transaction
+func (s *Store) Save(receiver *spot.Receiver, spots []*spot.Spot, received time.Time) error {
+	if len(spots) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.Prepare(insertReport)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	if receiver == nil {
+		receiver = &spot.Receiver{}
+	}
+
+	for _, sp := range spots {
+		// Spots without a flow start time are assumed to be fresh
+		t := received.UTC()
+		if sp.FlowStartSeconds() != 0 {
+			t = time.Unix(int64(sp.FlowStartSeconds()), 0).UTC()
+		}
+
+		_, err = insert.Exec(
+			t,
+			text(sp.Sender().Callsign),
+			text(receiver.Callsign),
+			text(sp.Sender().Locator),
+			text(receiver.Locator),
+			sp.Frequency(),
+			sp.SNR(),
+			sp.IMD(),
+			text(receiver.DecoderSoftware),
+			text(receiver.AntennaInformation),
+			text(sp.Mode()),
+			sp.InformationSource(),
+			text(receiver.PersistentIdentifier),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Fields that weren't sent are stored as NULL
+func text(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,417 @@
+package spot
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kahara/go-pskreporter-spot/bandplan"
+	"github.com/kahara/go-pskreporter-spot/maidenhead"
+	"github.com/prometheus/client_golang/prometheus"
+	"net"
+	"time"
+)
+
+var ErrConfig = errors.New("invalid configuration")
+
+// What Feed does with spots that don't pass Spot.Validate
+const (
+	SpotValidation_Off          = iota // Send them as they are
+	SpotValidation_StripLocator        // Send them without a locator if that's all that's wrong, drop them otherwise
+	SpotValidation_Strict              // Drop them
+)
+
+// What Feed does with spots of a mode that isn't an ADIF MODE or SUBMODE
+const (
+	UnknownMode_Flag = iota // Send them, warning about each such mode once
+	UnknownMode_Drop        // Drop them
+)
+
+// DistanceBuckets suit a histogram of spot distances in km, from ground wave to the other side of the world
+var DistanceBuckets = []float64{50, 100, 250, 500, 1000, 2000, 4000, 8000, 12000, 16000, 20000}
+
+// Config has everything that can be tuned per Spotter; the package constants are the defaults
+type Config struct {
+	Hostport                 string
+	Transport                int // Transport_UDP or Transport_TCP
+	Callsign                 string
+	Locator                  string
+	AntennaInformation       string // Optional
+	DecoderSoftware          string
+	RigInformation           string          // Optional
+	PersistentIdentifier     string          // Generated if empty...
+	PersistentIdentifierFile string          // ...and stored here if set, to be reused on the next run
+	SpotKind                 int             // One of SpotKind_*...
+	SenderFields             []Field         // ...or any combination of sender fields, which takes precedence
+	ReceiverFields           []Field         // Picked based on AntennaInformation and RigInformation if empty
+	FrequencySource          FrequencySource // Optional; resolves spots given as audio offsets
+	LocatorProvider          LocatorProvider // Optional; follows a receiver that moves
+	PacketMetric             *prometheus.CounterVec
+	DistanceMetric           *prometheus.HistogramVec // Optional; see WithDistanceMetric
+	SpotValidation           int                      // One of SpotValidation_*
+	UnknownModes             int                      // One of UnknownMode_*
+	DedupWindow              time.Duration            // Zero sends every spot...
+	DedupPolicy              int                      // ...otherwise one per sender, band and mode within the window, picked by one of DedupPolicy_*
+	SuppressedMetric         *prometheus.CounterVec   // Optional; counts spots left out by deduplication, labeled by "band" and "mode"
+	BandPlan                 bandplan.Plan            // Bands for deduplication and metric labels; bandplan.Worldwide if nil
+	Stages                   []Stage                  // Filters and transformers Feed runs spots through, in order
+	FilterMetric             *prometheus.CounterVec   // Optional; counts spots the stages dropped or changed, labeled by "filter" and "action"
+	Spool                    *Spool                   // Optional; see WithSpool
+
+	QueueSize                int
+	Overflow                 int                    // One of Overflow_*, for when the queue is full
+	OverflowMetric           *prometheus.CounterVec // Optional; counts spots dropped for lack of room, labeled by "band" and "mode"
+	MaxSpots                 int                    // Flush when this many spots are waiting...
+	LingerTime               time.Duration          // ...or when the oldest one has waited this long
+	InitialHeaderProbability float32
+	HeaderProbabilityBackoff float32
+	HeaderProbabilityLimit   float32
+	MaxPayloadBytes          int // Zero picks a limit based on transport and address family
+}
+
+// Option modifies a Config before a Spotter is built from it
+type Option func(*Config)
+
+func DefaultConfig() Config {
+	return Config{
+		Transport:                Transport_UDP,
+		SpotKind:                 SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart,
+		SpotValidation:           SpotValidation_Off,
+		QueueSize:                QueueSize,
+		MaxSpots:                 MaxSpots,
+		LingerTime:               LingerTime,
+		InitialHeaderProbability: InitialHeaderProbability,
+		HeaderProbabilityBackoff: HeaderProbabilityBackoff,
+		HeaderProbabilityLimit:   HeaderProbabilityLimit,
+	}
+}
+
+// WithTransport selects between Transport_UDP (the default) and Transport_TCP
+func WithTransport(transport int) Option {
+	return func(c *Config) {
+		c.Transport = transport
+	}
+}
+
+// WithSpool makes spots survive restarts by keeping them in spool until they've been sent;
+// the Spool should be closed only after the Spotter has been
+func WithSpool(spool *Spool) Option {
+	return func(c *Config) {
+		c.Spool = spool
+	}
+}
+
+// WithPersistentIdentifierFile keeps a generated persistent identifier in path, so that it stays the same across restarts
+func WithPersistentIdentifierFile(path string) Option {
+	return func(c *Config) {
+		c.PersistentIdentifierFile = path
+	}
+}
+
+// WithRigInformation describes the receiving radio, such as "IC-7300", in receiver records
+func WithRigInformation(rigInformation string) Option {
+	return func(c *Config) {
+		c.RigInformation = rigInformation
+	}
+}
+
+// WithFields picks exactly which fields go into receiver and sender records; nil keeps the default
+func WithFields(receiverFields []Field, senderFields []Field) Option {
+	return func(c *Config) {
+		c.ReceiverFields = receiverFields
+		c.SenderFields = senderFields
+	}
+}
+
+// FrequencySource tells the rig's current dial frequency in Hz, or false if it isn't known right now
+type FrequencySource interface {
+	DialFrequency() (uint64, bool)
+}
+
+// WithFrequencySource turns the audio offsets of spots fed with WithAudioOffset into RF frequencies
+func WithFrequencySource(source FrequencySource) Option {
+	return func(c *Config) {
+		c.FrequencySource = source
+	}
+}
+
+// LocatorProvider tells the receiver's current locator, or false if it isn't known right now
+type LocatorProvider interface {
+	Locator() (string, bool)
+}
+
+// WithLocatorProvider keeps the receiver locator up to date while running, such as from a GPS on a rover or a boat;
+// Config.Locator is used until the provider knows better
+func WithLocatorProvider(provider LocatorProvider) Option {
+	return func(c *Config) {
+		c.LocatorProvider = provider
+	}
+}
+
+// WithLocatorLookup fills in the locator of spots fed without one, e.g. from a callsign database; it adds a
+// FillLocator stage to the pipeline, named "locator"
+func WithLocatorLookup(lookup func(callsign string) string) Option {
+	return WithTransformer("locator", FillLocator(lookup))
+}
+
+// WithSpotValidation picks what to do with spots that don't pass Spot.Validate
+func WithSpotValidation(spotValidation int) Option {
+	return func(c *Config) {
+		c.SpotValidation = spotValidation
+	}
+}
+
+// WithUnknownModes picks what to do with spots of modes that aren't in the ADIF registry, see adif.Modes
+func WithUnknownModes(unknownModes int) Option {
+	return func(c *Config) {
+		c.UnknownModes = unknownModes
+	}
+}
+
+// WithDedup sends only one spot per sender, band and mode within window, such as DedupWindow, holding on to each
+// for the window to see whether a better one comes along; policy is one of DedupPolicy_*
+func WithDedup(window time.Duration, policy int) Option {
+	return func(c *Config) {
+		c.DedupWindow = window
+		c.DedupPolicy = policy
+	}
+}
+
+// WithBandPlan picks the bands of the receiver's region, such as bandplan.Region1, in place of bandplan.Worldwide
+func WithBandPlan(plan bandplan.Plan) Option {
+	return func(c *Config) {
+		c.BandPlan = plan
+	}
+}
+
+// WithBandFilter sends only spots on frequencies filter lets through, such as bandplan.Worldwide.From("6m") for
+// "6m and up", or bandplan.Worldwide.Contains to leave out spots that aren't on any band; it adds a Frequencies
+// stage to the pipeline, named "band"
+func WithBandFilter(filter func(frequency uint64) bool) Option {
+	return WithFilter("band", Frequencies(filter))
+}
+
+// WithFilter adds a stage to the pipeline that drops the spots filter doesn't let through, such as
+// DropCallsigns(callsign); name identifies it in FilterCounts and FilterMetric
+func WithFilter(name string, filter Filter) Option {
+	return func(c *Config) {
+		c.Stages = append(c.Stages, Stage{Name: name, Filter: filter})
+	}
+}
+
+// WithTransformer adds a stage to the pipeline that changes spots, such as ClampSNR(-30, 30)
+func WithTransformer(name string, transformer Transformer) Option {
+	return func(c *Config) {
+		c.Stages = append(c.Stages, Stage{Name: name, Transformer: transformer})
+	}
+}
+
+func WithFilterMetric(metric *prometheus.CounterVec) Option {
+	return func(c *Config) {
+		c.FilterMetric = metric
+	}
+}
+
+func WithSuppressedMetric(metric *prometheus.CounterVec) Option {
+	return func(c *Config) {
+		c.SuppressedMetric = metric
+	}
+}
+
+// WithDistanceMetric observes how far away each spot was heard from, in km, for spots with a sender locator;
+// the histogram is labeled by "band" and "mode"
+func WithDistanceMetric(metric *prometheus.HistogramVec) Option {
+	return func(c *Config) {
+		c.DistanceMetric = metric
+	}
+}
+
+func WithQueueSize(queueSize int) Option {
+	return func(c *Config) {
+		c.QueueSize = queueSize
+	}
+}
+
+// WithOverflow picks what Feed does when the queue is full, one of Overflow_*; the default is Overflow_Block
+func WithOverflow(policy int) Option {
+	return func(c *Config) {
+		c.Overflow = policy
+	}
+}
+
+func WithOverflowMetric(metric *prometheus.CounterVec) Option {
+	return func(c *Config) {
+		c.OverflowMetric = metric
+	}
+}
+
+// WithFlushThresholds sets how many spots, or how long a wait, makes the Spotter send
+func WithFlushThresholds(maxSpots int, lingerTime time.Duration) Option {
+	return func(c *Config) {
+		c.MaxSpots = maxSpots
+		c.LingerTime = lingerTime
+	}
+}
+
+// WithHeaderProbability tunes how often descriptors are included over UDP
+func WithHeaderProbability(initial float32, backoff float32, limit float32) Option {
+	return func(c *Config) {
+		c.InitialHeaderProbability = initial
+		c.HeaderProbabilityBackoff = backoff
+		c.HeaderProbabilityLimit = limit
+	}
+}
+
+func WithMaxPayloadBytes(maxPayloadBytes int) Option {
+	return func(c *Config) {
+		c.MaxPayloadBytes = maxPayloadBytes
+	}
+}
+
+// Validate reports the first thing about the Config that would keep a Spotter from working
+func (c Config) Validate() error {
+	if _, port, err := net.SplitHostPort(c.Hostport); err != nil || port == "" {
+		return fmt.Errorf("%w: hostport %q", ErrConfig, c.Hostport)
+	}
+
+	if c.Transport != Transport_UDP && c.Transport != Transport_TCP {
+		return fmt.Errorf("%w: transport %d", ErrConfig, c.Transport)
+	}
+
+	for _, field := range []struct {
+		name     string
+		value    string
+		required bool
+	}{
+		{"callsign", c.Callsign, true},
+		{"locator", c.Locator, false},
+		{"antenna information", c.AntennaInformation, false},
+		{"decoder software", c.DecoderSoftware, true},
+		{"rig information", c.RigInformation, false},
+		{"persistent identifier", c.PersistentIdentifier, false},
+	} {
+		if field.required && field.value == "" {
+			return fmt.Errorf("%w: %s is required", ErrConfig, field.name)
+		}
+		if len(field.value) > MaxStringLength {
+			return fmt.Errorf("%w: %s is longer than %d bytes", ErrConfig, field.name, MaxStringLength)
+		}
+	}
+
+	// A receiver that doesn't know where it is, such as one waiting for a LocatorProvider, can do without
+	if c.Locator != "" && !maidenhead.Valid(c.Locator) {
+		return fmt.Errorf("%w: locator %q", ErrConfig, c.Locator)
+	}
+
+	if c.SpotValidation < SpotValidation_Off || c.SpotValidation > SpotValidation_Strict {
+		return fmt.Errorf("%w: spot validation %d", ErrConfig, c.SpotValidation)
+	}
+
+	if c.UnknownModes != UnknownMode_Flag && c.UnknownModes != UnknownMode_Drop {
+		return fmt.Errorf("%w: unknown modes %d", ErrConfig, c.UnknownModes)
+	}
+
+	if c.DedupWindow < 0 || c.DedupPolicy < DedupPolicy_BestSNR || c.DedupPolicy > DedupPolicy_Latest {
+		return fmt.Errorf("%w: dedup window %s, policy %d", ErrConfig, c.DedupWindow, c.DedupPolicy)
+	}
+
+	names := make(map[string]bool)
+	for _, stage := range c.Stages {
+		if stage.Name == "" || names[stage.Name] || (stage.Filter == nil) == (stage.Transformer == nil) {
+			return fmt.Errorf("%w: stage %q", ErrConfig, stage.Name)
+		}
+		names[stage.Name] = true
+	}
+
+	if c.SenderFields == nil && SenderFields(c.SpotKind) == nil {
+		return fmt.Errorf("%w: spot kind %d", ErrConfig, c.SpotKind)
+	}
+
+	receiverTemplate, senderTemplate := c.templates()
+	if err := receiverTemplate.validate(allowedReceiverFields, Field_ReceiverCallsign); err != nil {
+		return fmt.Errorf("%w: %v", ErrConfig, err)
+	}
+	if err := senderTemplate.validate(allowedSenderFields, Field_SenderCallsign); err != nil {
+		return fmt.Errorf("%w: %v", ErrConfig, err)
+	}
+
+	if c.QueueSize < 1 {
+		return fmt.Errorf("%w: queue size %d", ErrConfig, c.QueueSize)
+	}
+	if c.Overflow < Overflow_Block || c.Overflow > Overflow_Coalesce {
+		return fmt.Errorf("%w: overflow %d", ErrConfig, c.Overflow)
+	}
+	if c.MaxSpots < 1 || c.MaxSpots > c.QueueSize {
+		return fmt.Errorf("%w: max spots %d with queue size %d", ErrConfig, c.MaxSpots, c.QueueSize)
+	}
+	if c.LingerTime <= 0 {
+		return fmt.Errorf("%w: linger time %s", ErrConfig, c.LingerTime)
+	}
+
+	if c.InitialHeaderProbability < 0 || c.HeaderProbabilityBackoff <= 0 || c.HeaderProbabilityBackoff > 1 || c.HeaderProbabilityLimit < 0 || c.HeaderProbabilityLimit > 1 {
+		return fmt.Errorf("%w: header probability %f, backoff %f, limit %f", ErrConfig, c.InitialHeaderProbability, c.HeaderProbabilityBackoff, c.HeaderProbabilityLimit)
+	}
+
+	if c.MaxPayloadBytes != 0 && (c.MaxPayloadBytes < MinPayloadBytes || c.MaxPayloadBytes > TCPMaxPayloadBytes) {
+		return fmt.Errorf("%w: max payload bytes %d", ErrConfig, c.MaxPayloadBytes)
+	}
+
+	// A metric with other labels than a Spotter gives it would only panic once spots are fed
+	for _, metric := range []struct {
+		name   string
+		vec    *prometheus.MetricVec
+		labels int
+	}{
+		{"packet metric", counterVec(c.PacketMetric), 2},         // Network and address
+		{"distance metric", histogramVec(c.DistanceMetric), 2},   // Band and mode
+		{"suppressed metric", counterVec(c.SuppressedMetric), 2}, // Band and mode
+		{"filter metric", counterVec(c.FilterMetric), 2},         // Filter and action
+		{"overflow metric", counterVec(c.OverflowMetric), 2},     // Band and mode
+	} {
+		if metric.vec != nil && !hasLabels(metric.vec, metric.labels) {
+			return fmt.Errorf("%w: %s doesn't have %d labels", ErrConfig, metric.name, metric.labels)
+		}
+	}
+
+	return nil
+}
+
+func counterVec(metric *prometheus.CounterVec) *prometheus.MetricVec {
+	if metric == nil {
+		return nil
+	}
+	return metric.MetricVec
+}
+
+func histogramVec(metric *prometheus.HistogramVec) *prometheus.MetricVec {
+	if metric == nil {
+		return nil
+	}
+	return metric.MetricVec
+}
+
+// Whether a metric takes as many label values as given; the series made to find out is deleted right away
+func hasLabels(vec *prometheus.MetricVec, labels int) bool {
+	values := make([]string, labels)
+	if _, err := vec.GetMetricWithLabelValues(values...); err != nil {
+		return false
+	}
+	vec.DeleteLabelValues(values...)
+	return true
+}
+
+// Receiver and sender templates for the configured fields
+func (c Config) templates() (*Template, *Template) {
+	receiverFields := c.ReceiverFields
+	if receiverFields == nil {
+		receiverFields = ReceiverFields(c.AntennaInformation != "")
+		if c.RigInformation != "" {
+			receiverFields = append(receiverFields, Field_RigInformation)
+		}
+	}
+
+	senderFields := c.SenderFields
+	if senderFields == nil {
+		senderFields = SenderFields(c.SpotKind)
+	}
+
+	return NewOptionsTemplate(ReceiverTemplateID, receiverFields...), NewTemplate(SenderTemplateID, senderFields...)
+}
@@ -0,0 +1,120 @@
+package spot
+
+import (
+	"context"
+	"errors"
+	"github.com/kahara/go-pskreporter-spot/bandplan"
+	"github.com/prometheus/client_golang/prometheus"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validConfig() Config {
+	config := DefaultConfig()
+	config.Hostport = "localhost:4739"
+	config.Callsign = "N0CALL"
+	config.Locator = "JJ00OG"
+	config.DecoderSoftware = "fakespot v0"
+	return config
+}
+
+func TestConfig(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("expected default config to be valid, got %v", err)
+	}
+
+	// As before locators were validated
+	config := validConfig()
+	config.Locator = ""
+	if err := config.Validate(); err != nil {
+		t.Errorf("expected a config without a locator to be valid, got %v", err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		option Option
+	}{
+		{"hostport", func(c *Config) { c.Hostport = "localhost" }},
+		{"transport", WithTransport(42)},
+		{"callsign", func(c *Config) { c.Callsign = "" }},
+		{"locator typo", func(c *Config) { c.Locator = "JJ00OGG" }},
+		{"spot validation", WithSpotValidation(42)},
+		{"unknown modes", WithUnknownModes(42)},
+		{"dedup window", WithDedup(-time.Second, DedupPolicy_BestSNR)},
+		{"dedup policy", WithDedup(DedupWindow, 42)},
+		{"unnamed stage", WithFilter("", DropCallsigns("N1CALL"))},
+		{"duplicate stage", func(c *Config) {
+			WithFilter("own", DropCallsigns("N1CALL"))(c)
+			WithTransformer("own", ClampSNR(-30, 30))(c)
+		}},
+		{"empty stage", func(c *Config) { c.Stages = []Stage{{Name: "empty"}} }},
+		{"band stage", func(c *Config) {
+			WithBandFilter(bandplan.Worldwide.Contains)(c)
+			WithFilter("band", DropCallsigns("N1CALL"))(c)
+		}},
+		{"decoder software", func(c *Config) { c.DecoderSoftware = "" }},
+		{"antenna information", func(c *Config) { c.AntennaInformation = strings.Repeat("x", MaxStringLength+1) }},
+		{"spot kind", func(c *Config) { c.SpotKind = -1 }},
+		{"queue size", WithQueueSize(0)},
+		{"overflow", WithOverflow(42)},
+		{"max spots", WithFlushThresholds(QueueSize+1, LingerTime)},
+		{"linger time", WithFlushThresholds(MaxSpots, 0)},
+		{"header probability backoff", WithHeaderProbability(InitialHeaderProbability, 1.5, HeaderProbabilityLimit)},
+		{"header probability limit", WithHeaderProbability(InitialHeaderProbability, HeaderProbabilityBackoff, -1)},
+		{"max payload bytes", WithMaxPayloadBytes(MinPayloadBytes - 1)},
+		{"packet metric", func(c *Config) {
+			c.PacketMetric = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "packets"}, []string{"address"})
+		}},
+		{"distance metric", WithDistanceMetric(prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "distance"}, []string{"band"}))},
+		{"suppressed metric", WithSuppressedMetric(prometheus.NewCounterVec(prometheus.CounterOpts{Name: "suppressed"}, []string{"band", "mode", "extra"}))},
+		{"filter metric", WithFilterMetric(prometheus.NewCounterVec(prometheus.CounterOpts{Name: "filtered"}, nil))},
+		{"overflow metric", WithOverflowMetric(prometheus.NewCounterVec(prometheus.CounterOpts{Name: "overflowed"}, []string{"mode"}))},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig()
+			tt.option(&config)
+			if err := config.Validate(); !errors.Is(err, ErrConfig) {
+				t.Errorf("expected %v, got %v", ErrConfig, err)
+			}
+		})
+	}
+}
+
+func TestNewSpotterFromConfig(t *testing.T) {
+	if _, err := NewSpotterFromConfig(validConfig(), WithQueueSize(-1)); !errors.Is(err, ErrConfig) {
+		t.Errorf("expected %v, got %v", ErrConfig, err)
+	}
+
+	// Checking the labels of a metric leaves nothing behind
+	overflowed := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "overflowed"}, []string{"band", "mode"})
+	if _, err := NewSpotterFromConfig(validConfig(), WithOverflowMetric(overflowed)); err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(overflowed)
+	if families, err := registry.Gather(); err != nil || len(families) != 0 {
+		t.Errorf("expected no series, got %+v, %v", families, err)
+	}
+
+	// Without a callsign, a Spotter that only drops spots
+	disabled := NewSpotter("localhost:4739", "", "JJ00OG", "", "fakespot v0", "", SpotKind_CallsignFrequencyModeSourceFlowstart, nil)
+	if err := disabled.TryFeed(NewSpot("N1CALL", "II00OG", 50313650, -3, 2, "FT8", 1, 1670000000)); !errors.Is(err, ErrConfig) {
+		t.Errorf("expected %v, got %v", ErrConfig, err)
+	}
+	disabled.Feed(NewSpot("N1CALL", "II00OG", 50313650, -3, 2, "FT8", 1, 1670000000))
+	if !errors.Is(disabled.Err(), ErrConfig) || !errors.Is(disabled.Start(context.Background()), ErrConfig) || disabled.QueueDepth() != 0 {
+		t.Errorf("expected a disabled spotter, got %v and %d queued", disabled.Err(), disabled.QueueDepth())
+	}
+	disabled.Close()
+
+	spotter, err := NewSpotterFromConfig(validConfig(), WithQueueSize(50), WithFlushThresholds(10, time.Minute), WithMaxPayloadBytes(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spotter.Close()
+
+	if spotter.queue.size != 50 || spotter.maxSpots != 10 || spotter.lingerTime != time.Minute || spotter.maxPayloadBytes != 1000 {
+		t.Errorf("options not applied: %+v", spotter)
+	}
+}
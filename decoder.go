@@ -0,0 +1,391 @@
+package spot
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// See https://pskreporter.info/pskdev.html and RFC 5101
+
+const (
+	EnterpriseNumber      = 30351 // PSK Reporter's private enterprise number
+	VariableLength        = 0xFFFF
+	TemplateSetID         = 2
+	OptionsTemplateSetID  = 3
+	MinDataSetID          = 256
+	setHeaderLength       = 4
+	enterpriseBit         = 0x8000
+	longVariableLengthTag = 0xFF
+)
+
+// Information element IDs; the ones below 150 are in PSK Reporter's enterprise space
+const (
+	Element_SenderCallsign       = 1
+	Element_ReceiverCallsign     = 2
+	Element_SenderLocator        = 3
+	Element_ReceiverLocator      = 4
+	Element_Frequency            = 5
+	Element_SNR                  = 6
+	Element_IMD                  = 7
+	Element_DecoderSoftware      = 8
+	Element_AntennaInformation   = 9
+	Element_Mode                 = 10
+	Element_InformationSource    = 11
+	Element_PersistentIdentifier = 12
+	Element_RigInformation       = 13
+	Element_SenderDXCCADIF       = 16
+	Element_SenderRegion         = 17
+	Element_FlowStartSeconds     = 150 // IANA, no enterprise number
+)
+
+var (
+	ErrShortMessage    = errors.New("message is too short")
+	ErrVersion         = errors.New("unsupported IPFIX version")
+	ErrMessageLength   = errors.New("message length does not match header")
+	ErrSetLength       = errors.New("set length is invalid")
+	ErrTemplate        = errors.New("template is malformed")
+	ErrUnknownTemplate = errors.New("data set refers to an unknown template")
+	ErrRecordTruncated = errors.New("record is truncated")
+)
+
+// Field is a field specifier of a template
+type Field struct {
+	ElementID        uint16
+	Length           uint16 // VariableLength for variable-length fields
+	EnterpriseNumber uint32 // Zero for IANA elements
+}
+
+// Template is a (options) template record
+type Template struct {
+	ID              uint16
+	Options         bool   // Whether this is an options template
+	ScopeFieldCount uint16 // Only non-zero for options templates
+	Fields          []Field
+}
+
+// Receiver is the decoded contents of a receiver record
+type Receiver struct {
+	Station
+	DecoderSoftware      string
+	AntennaInformation   string
+	PersistentIdentifier string
+	RigInformation       string
+}
+
+// Message is a decoded IPFIX message
+type Message struct {
+	ExportTime        uint32
+	SequenceNumber    uint32
+	ObservationDomain uint32
+	Templates         []*Template // Templates defined (or withdrawn) by this message
+	Receivers         []*Receiver
+	Spots             []*Spot
+}
+
+// Decoder parses IPFIX messages, remembering templates per observation domain
+type Decoder struct {
+	templates map[uint32]map[uint16]*Template
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		templates: make(map[uint32]map[uint16]*Template),
+	}
+}
+
+// Template returns a template previously learned for the observation domain, or nil
+func (d *Decoder) Template(observationDomain uint32, id uint16) *Template {
+	return d.templates[observationDomain][id]
+}
+
+// Decode parses a single IPFIX message, such as one produced by IPFIX()
+func (d *Decoder) Decode(datagram []byte) (*Message, error) {
+	if len(datagram) < HeaderLength {
+		return nil, ErrShortMessage
+	}
+
+	if datagram[0] != Header[0] || datagram[1] != Header[1] {
+		return nil, fmt.Errorf("%w: 0x%04X", ErrVersion, binary.BigEndian.Uint16(datagram[0:]))
+	}
+
+	length := int(binary.BigEndian.Uint16(datagram[2:]))
+	if length != len(datagram) {
+		return nil, fmt.Errorf("%w: header says %d, got %d bytes", ErrMessageLength, length, len(datagram))
+	}
+
+	message := &Message{
+		ExportTime:        binary.BigEndian.Uint32(datagram[4:]),
+		SequenceNumber:    binary.BigEndian.Uint32(datagram[8:]),
+		ObservationDomain: binary.BigEndian.Uint32(datagram[12:]),
+	}
+
+	if d.templates[message.ObservationDomain] == nil {
+		d.templates[message.ObservationDomain] = make(map[uint16]*Template)
+	}
+
+	// Walk through the sets
+	for rest := datagram[HeaderLength:]; len(rest) > 0; {
+		if len(rest) < setHeaderLength {
+			return nil, fmt.Errorf("%w: %d trailing bytes", ErrSetLength, len(rest))
+		}
+
+		setID := binary.BigEndian.Uint16(rest[0:])
+		setLength := int(binary.BigEndian.Uint16(rest[2:]))
+		if setLength < setHeaderLength || setLength > len(rest) {
+			return nil, fmt.Errorf("%w: set 0x%04X has length %d", ErrSetLength, setID, setLength)
+		}
+		set := rest[setHeaderLength:setLength]
+		rest = rest[setLength:]
+
+		var err error
+		switch {
+		case setID == TemplateSetID || setID == OptionsTemplateSetID:
+			err = d.decodeTemplateSet(message, setID == OptionsTemplateSetID, set)
+		case setID >= MinDataSetID:
+			err = d.decodeDataSet(message, setID, set)
+		default:
+			err = fmt.Errorf("%w: reserved set ID 0x%04X", ErrSetLength, setID)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return message, nil
+}
+
+// ReadMessage reads one IPFIX message from a stream, such as a TCP connection, relying on the length in its header
+func ReadMessage(reader io.Reader) ([]byte, error) {
+	header := make([]byte, HeaderLength)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+
+	length := int(binary.BigEndian.Uint16(header[2:]))
+	if length < HeaderLength {
+		return nil, fmt.Errorf("%w: header says %d", ErrMessageLength, length)
+	}
+
+	message := make([]byte, length)
+	copy(message, header)
+	if _, err := io.ReadFull(reader, message[HeaderLength:]); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+func (d *Decoder) decodeTemplateSet(message *Message, options bool, set []byte) error {
+	templates := d.templates[message.ObservationDomain]
+
+	headerLength := 4
+	if options {
+		headerLength = 6
+	}
+
+	for len(set) >= headerLength {
+		template := &Template{
+			ID:      binary.BigEndian.Uint16(set[0:]),
+			Options: options,
+		}
+		fieldCount := int(binary.BigEndian.Uint16(set[2:]))
+		if options {
+			template.ScopeFieldCount = binary.BigEndian.Uint16(set[4:])
+		}
+
+		// Zero is never a valid template ID, so this can only be padding
+		if template.ID == 0 && isPadding(set) {
+			break
+		}
+		if template.ID < MinDataSetID {
+			return fmt.Errorf("%w: template ID 0x%04X", ErrTemplate, template.ID)
+		}
+		set = set[headerLength:]
+
+		for i := 0; i < fieldCount; i++ {
+			var field Field
+			if len(set) < 4 {
+				return fmt.Errorf("%w: template 0x%04X is truncated", ErrTemplate, template.ID)
+			}
+			field.ElementID = binary.BigEndian.Uint16(set[0:])
+			field.Length = binary.BigEndian.Uint16(set[2:])
+			set = set[4:]
+			if field.ElementID&enterpriseBit != 0 {
+				if len(set) < 4 {
+					return fmt.Errorf("%w: template 0x%04X is truncated", ErrTemplate, template.ID)
+				}
+				field.ElementID &^= enterpriseBit
+				field.EnterpriseNumber = binary.BigEndian.Uint32(set[0:])
+				set = set[4:]
+			}
+			// Fixed-length fields are at most a reduced-size unsigned integer, and can't be empty
+			if field.Length == 0 || (field.Length != VariableLength && field.Length > 8) {
+				return fmt.Errorf("%w: template 0x%04X has a field of length %d", ErrTemplate, template.ID, field.Length)
+			}
+			template.Fields = append(template.Fields, field)
+		}
+
+		// A template with no fields withdraws a previous one
+		if fieldCount == 0 {
+			delete(templates, template.ID)
+		} else {
+			templates[template.ID] = template
+		}
+		message.Templates = append(message.Templates, template)
+	}
+
+	if !isPadding(set) {
+		return fmt.Errorf("%w: %d trailing bytes in template set", ErrTemplate, len(set))
+	}
+
+	return nil
+}
+
+func (d *Decoder) decodeDataSet(message *Message, setID uint16, set []byte) error {
+	template := d.templates[message.ObservationDomain][setID]
+	if template == nil {
+		return fmt.Errorf("%w: 0x%04X in observation domain 0x%08X", ErrUnknownTemplate, setID, message.ObservationDomain)
+	}
+
+	receiver := template.has(Element_ReceiverCallsign)
+	minimum := template.minRecordLength()
+
+	for len(set) >= minimum && !isPadding(set) {
+		var (
+			values map[Field][]byte
+			rest   []byte
+			err    error
+		)
+
+		values, rest, err = template.decodeRecord(set)
+		if err != nil {
+			return err
+		}
+		if len(rest) == len(set) {
+			return fmt.Errorf("%w: record of template 0x%04X is empty", ErrTemplate, setID)
+		}
+		set = rest
+
+		if receiver {
+			message.Receivers = append(message.Receivers, decodeReceiver(values))
+		} else {
+			spot := decodeSpot(values)
+			if len(message.Receivers) > 0 {
+				spot.receiver = message.Receivers[len(message.Receivers)-1].Station
+			}
+			message.Spots = append(message.Spots, spot)
+		}
+	}
+
+	return nil
+}
+
+// Split a record into values by field, returning whatever remains of the set
+func (t *Template) decodeRecord(set []byte) (map[Field][]byte, []byte, error) {
+	values := make(map[Field][]byte, len(t.Fields))
+
+	for _, field := range t.Fields {
+		length := int(field.Length)
+		if field.Length == VariableLength {
+			if len(set) < 1 {
+				return nil, nil, ErrRecordTruncated
+			}
+			length = int(set[0])
+			set = set[1:]
+			if length == longVariableLengthTag {
+				if len(set) < 2 {
+					return nil, nil, ErrRecordTruncated
+				}
+				length = int(binary.BigEndian.Uint16(set[0:]))
+				set = set[2:]
+			}
+		}
+
+		if len(set) < length {
+			return nil, nil, ErrRecordTruncated
+		}
+		values[field.key()] = set[:length]
+		set = set[length:]
+	}
+
+	return values, set, nil
+}
+
+func (t *Template) has(elementID uint16) bool {
+	for _, field := range t.Fields {
+		if field.ElementID == elementID && field.EnterpriseNumber == EnterpriseNumber {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Template) minRecordLength() int {
+	length := 0
+	for _, field := range t.Fields {
+		if field.Length == VariableLength {
+			length += 1
+		} else {
+			length += int(field.Length)
+		}
+	}
+	if length == 0 {
+		length = 1
+	}
+	return length
+}
+
+func decodeReceiver(values map[Field][]byte) *Receiver {
+	return &Receiver{
+		Station: Station{
+			Callsign: string(values[pskField(Element_ReceiverCallsign)]),
+			Locator:  string(values[pskField(Element_ReceiverLocator)]),
+		},
+		DecoderSoftware:      string(values[pskField(Element_DecoderSoftware)]),
+		AntennaInformation:   string(values[pskField(Element_AntennaInformation)]),
+		PersistentIdentifier: string(values[pskField(Element_PersistentIdentifier)]),
+		RigInformation:       string(values[pskField(Element_RigInformation)]),
+	}
+}
+
+func decodeSpot(values map[Field][]byte) *Spot {
+	return &Spot{
+		sender: Station{
+			Callsign: string(values[pskField(Element_SenderCallsign)]),
+			Locator:  string(values[pskField(Element_SenderLocator)]),
+		},
+		frequency:         decodeUnsigned(values[pskField(Element_Frequency)]),
+		snr:               int8(decodeUnsigned(values[pskField(Element_SNR)])),
+		imd:               uint8(decodeUnsigned(values[pskField(Element_IMD)])),
+		mode:              string(values[pskField(Element_Mode)]),
+		informationSource: uint8(decodeUnsigned(values[pskField(Element_InformationSource)])),
+		flowStartSeconds:  uint32(decodeUnsigned(values[Field_FlowStartSeconds.key()])),
+		dxcc:              uint16(decodeUnsigned(values[pskField(Element_SenderDXCCADIF)])),
+		region:            string(values[pskField(Element_SenderRegion)]),
+	}
+}
+
+// Key for looking up a value decoded from a field in PSK Reporter's enterprise space; see Field.key
+func pskField(elementID uint16) Field {
+	return Field{ElementID: elementID, EnterpriseNumber: EnterpriseNumber}
+}
+
+// Big-endian unsigned integer of any (reduced-size) length up to eight bytes
+func decodeUnsigned(value []byte) uint64 {
+	var result uint64
+	for _, b := range value {
+		result = result<<8 | uint64(b)
+	}
+	return result
+}
+
+func isPadding(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
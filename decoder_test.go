@@ -0,0 +1,52 @@
+package spot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecoderErrors(t *testing.T) {
+	valid := IPFIX(0, 0, SenderDescriptor_CallsignFrequencyModeSourceFlowstart, nil)
+
+	for _, tt := range []struct {
+		name     string
+		datagram []byte
+		err      error
+	}{
+		{"short", valid[:HeaderLength-1], ErrShortMessage},
+		{"version", append([]byte{0x00, 0x09}, valid[2:]...), ErrVersion},
+		{"length", valid[:len(valid)-4], ErrMessageLength},
+		{"set length", IPFIX(0, 0, []byte{0x00, 0x02, 0x00, 0x40, 0x00, 0x00, 0x00, 0x00}, nil), ErrSetLength},
+		{"template ID", IPFIX(0, 0, []byte{0x00, 0x02, 0x00, 0x08, 0x00, 0x10, 0x00, 0x01}, nil), ErrTemplate},
+		{"truncated template", IPFIX(0, 0, []byte{0x00, 0x02, 0x00, 0x08, 0x99, 0x93, 0x00, 0x01}, nil), ErrTemplate},
+		{"empty field", IPFIX(0, 0, []byte{0x00, 0x02, 0x00, 0x10, 0x99, 0x93, 0x00, 0x01, 0x80, 0x01, 0x00, 0x00, 0x00, 0x00, 0x76, 0x8F}, nil), ErrTemplate},
+		{"long field", IPFIX(0, 0, []byte{0x00, 0x02, 0x00, 0x10, 0x99, 0x93, 0x00, 0x01, 0x80, 0x05, 0x00, 0x09, 0x00, 0x00, 0x76, 0x8F}, nil), ErrTemplate},
+		{"unknown template", IPFIX(0, 0, nil, []byte{0x99, 0x93, 0x00, 0x08, 0x01, 0x02, 0x03, 0x04}), ErrUnknownTemplate},
+		{"truncated record", IPFIX(0, 0, SenderDescriptor_CallsignFrequencyModeSourceFlowstart, []byte{0x99, 0x93, 0x00, 0x10, 0x06, 'N', '1', 'C', 'A', 'L', 'L', 0x00, 0x00, 0x00, 0x00, 0x01}), ErrRecordTruncated},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDecoder().Decode(tt.datagram)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestDecoderTemplateWithdrawal(t *testing.T) {
+	decoder := NewDecoder()
+
+	if _, err := decoder.Decode(IPFIX(0, 7, SenderDescriptor_CallsignFrequencyModeSourceFlowstart, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if decoder.Template(7, 0x9993) == nil {
+		t.Fatal("expected template to be learned")
+	}
+
+	if _, err := decoder.Decode(IPFIX(1, 7, []byte{0x00, 0x02, 0x00, 0x08, 0x99, 0x93, 0x00, 0x00}, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if decoder.Template(7, 0x9993) != nil {
+		t.Error("expected template to be withdrawn")
+	}
+}
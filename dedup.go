@@ -0,0 +1,108 @@
+package spot
+
+import (
+	"github.com/kahara/go-pskreporter-spot/bandplan"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+// Which of the spots of the same sender, band and mode within a dedup window gets sent
+const (
+	DedupPolicy_BestSNR = iota // The one with the best SNR, or the first of equals
+	DedupPolicy_Latest         // The last one
+)
+
+const DedupWindow = 5 * time.Minute // A reasonable window, when deduplicating
+
+// Spots outside every band of the plan share bandplan.OutOfBand, like they do in the metrics' band label
+type dedupKey struct {
+	callsign string
+	band     string
+	mode     string
+}
+
+func newDedupKey(spot *Spot, plan bandplan.Plan) dedupKey {
+	return dedupKey{spot.sender.Callsign, plan.Name(spot.frequency), spot.mode}
+}
+
+type dedupEntry struct {
+	spot   *Spot
+	opened time.Time
+}
+
+// Holds on to the first spot of each sender, band and mode for a window, replacing it with better ones that come
+// along, and lets it go once the window has passed
+type dedup struct {
+	window     time.Duration
+	policy     int
+	plan       bandplan.Plan
+	metric     *prometheus.CounterVec
+	mutex      sync.Mutex
+	entries    map[dedupKey]*dedupEntry
+	order      []dedupKey // Oldest window first
+	suppressed int
+}
+
+func newDedup(window time.Duration, policy int, plan bandplan.Plan, metric *prometheus.CounterVec) *dedup {
+	return &dedup{
+		window:  window,
+		policy:  policy,
+		plan:    plan,
+		metric:  metric,
+		entries: make(map[dedupKey]*dedupEntry),
+	}
+}
+
+// Add a spot, which either opens a window or gets compared with the one already held; returns the one of the two
+// that won't be sent, if any
+func (d *dedup) add(spot *Spot, now time.Time) *Spot {
+	key := newDedupKey(spot, d.plan)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	entry, found := d.entries[key]
+	if !found {
+		d.entries[key] = &dedupEntry{spot, now}
+		d.order = append(d.order, key)
+		return nil
+	}
+
+	suppressed := spot
+	if d.policy == DedupPolicy_Latest || spot.snr > entry.spot.snr {
+		suppressed, entry.spot = entry.spot, spot
+	}
+	d.suppressed++
+	if d.metric != nil {
+		d.metric.WithLabelValues(d.plan.Name(spot.frequency), spot.mode).Inc()
+	}
+	return suppressed
+}
+
+// Take the spots whose window has passed by now, oldest first, but no more than max
+func (d *dedup) expired(now time.Time, max int) []*Spot {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var spots []*Spot
+	for len(d.order) > 0 && len(spots) < max {
+		key := d.order[0]
+		entry := d.entries[key]
+		if !now.IsZero() && now.Sub(entry.opened) < d.window {
+			break
+		}
+		spots = append(spots, entry.spot)
+		delete(d.entries, key)
+		d.order = d.order[1:]
+	}
+
+	return spots
+}
+
+func (d *dedup) len() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return len(d.order)
+}
@@ -0,0 +1,93 @@
+package spot
+
+import (
+	"github.com/kahara/go-pskreporter-spot/bandplan"
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+	"time"
+)
+
+func TestDedupKey(t *testing.T) {
+	for _, tt := range []struct {
+		frequency uint64
+		want      string
+	}{
+		{1840000, "160m"},
+		{14074000, "20m"},
+		{14350000, "20m"},
+		{50313000, "6m"},
+		{10368100000, "3cm"},
+		{53000000, bandplan.OutOfBand}, // Not in Region 1
+		{15000000, bandplan.OutOfBand},
+	} {
+		if got := newDedupKey(NewSpot("N1CALL", "", tt.frequency, 0, 0, "FT8", 1, 0), bandplan.Region1); got.band != tt.want {
+			t.Errorf("%d: expected %s, got %s", tt.frequency, tt.want, got.band)
+		}
+	}
+}
+
+func TestDedup(t *testing.T) {
+	start := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		name   string
+		policy int
+		want   []int8 // SNRs of the spots let through
+	}{
+		{"best SNR", DedupPolicy_BestSNR, []int8{-3, 5, -20}},
+		{"latest", DedupPolicy_Latest, []int8{-10, 5, -20}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			metric := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "suppressed"}, []string{"band", "mode"})
+			d := newDedup(DedupWindow, tt.policy, bandplan.Worldwide, metric)
+
+			d.add(NewSpot("N1CALL", "", 14074000, -15, 0, "FT8", 1, 0), start)
+			d.add(NewSpot("N1CALL", "", 14075500, -3, 0, "FT8", 1, 0), start.Add(time.Minute))  // Same band
+			d.add(NewSpot("N1CALL", "", 14074000, -10, 0, "FT8", 1, 0), start.Add(time.Minute)) // Not as good
+			d.add(NewSpot("N1CALL", "", 7074000, 5, 0, "FT8", 1, 0), start.Add(time.Minute))    // Another band
+			d.add(NewSpot("N1CALL", "", 14074000, -20, 0, "FT4", 1, 0), start.Add(2*time.Minute))
+
+			if spots := d.expired(start.Add(DedupWindow-time.Second), 10); len(spots) != 0 {
+				t.Errorf("expected nothing before the window has passed, got %d spots", len(spots))
+			}
+			if spots := d.expired(start.Add(DedupWindow+time.Minute), 1); len(spots) != 1 || spots[0].snr != tt.want[0] {
+				t.Fatalf("expected one spot with SNR %d, got %+v", tt.want[0], spots)
+			}
+
+			spots := d.expired(start.Add(DedupWindow+time.Minute), 10)
+			if len(spots) != 1 || spots[0].snr != tt.want[1] {
+				t.Fatalf("expected one spot with SNR %d, got %+v", tt.want[1], spots)
+			}
+
+			// Zero time lets go of everything
+			spots = d.expired(time.Time{}, 10)
+			if len(spots) != 1 || spots[0].snr != tt.want[2] || d.len() != 0 {
+				t.Fatalf("expected one spot with SNR %d and nothing left, got %+v", tt.want[2], spots)
+			}
+
+			// A window once passed starts over
+			d.add(NewSpot("N1CALL", "", 14074000, -15, 0, "FT8", 1, 0), start.Add(DedupWindow+2*time.Minute))
+			if d.len() != 1 || d.suppressed != 2 {
+				t.Errorf("expected 1 spot held and 2 suppressed, got %d and %d", d.len(), d.suppressed)
+			}
+		})
+	}
+}
+
+func TestSpotterDedupSpool(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir(), SpoolOptions{Sync: SpoolSync_Never})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = spool.Close() }()
+	spotter := newTestSpotter(t, SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, "", WithSpool(spool), WithDedup(DedupWindow, DedupPolicy_BestSNR))
+
+	spotter.Feed(NewSpot("N1CALL", "II00OG", 14074000, -15, 0, "FT8", 1, 1670000000))
+	spotter.Feed(NewSpot("N1CALL", "II00OG", 14075500, -3, 0, "FT8", 1, 1670000015))
+	spotter.Feed(NewSpot("N1CALL", "II00OG", 14074000, -10, 0, "FT8", 1, 1670000030))
+
+	// Held back, but spooled, and only the one that will be sent
+	if pending := spool.Pending(); spotter.queue.len() != 0 || len(pending) != 1 || pending[0].snr != -3 {
+		t.Errorf("expected nothing queued and the spot with SNR -3 spooled, got %d and %+v", spotter.queue.len(), pending)
+	}
+}
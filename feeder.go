@@ -0,0 +1,64 @@
+package spot
+
+import (
+	"context"
+	"github.com/rs/zerolog/log"
+	"math"
+	"net"
+	"time"
+)
+
+// Feeder is what decoders and skimmers feed spots into; usually a *Spotter
+type Feeder interface {
+	Feed(spot *Spot)
+}
+
+// ClampedSNR fits an SNR, as a decoder reports it, into what a spot carries
+func ClampedSNR(snr int) int8 {
+	if snr > math.MaxInt8 {
+		return math.MaxInt8
+	}
+	if snr < math.MinInt8 {
+		return math.MinInt8
+	}
+	return int8(snr)
+}
+
+// Redial connects to a TCP server at address and has serve handle the connection, connecting again after delay
+// whenever it's lost, until ctx is done; the connection is closed when ctx is done, which is how serve learns about
+// it. name says what's at the other end, for the logs
+func Redial(ctx context.Context, name string, address string, delay time.Duration, serve func(conn net.Conn) error) error {
+	var dialer net.Dialer
+
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err == nil {
+			log.Info().Str("address", address).Msgf("Connected to %s", name)
+			err = serveUntilDone(ctx, conn, serve)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Warn().Err(err).Str("address", address).Dur("delay", delay).Msgf("%s unavailable, reconnecting", name)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+func serveUntilDone(ctx context.Context, conn net.Conn, serve func(conn net.Conn) error) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		_ = conn.Close()
+	}()
+
+	return serve(conn)
+}
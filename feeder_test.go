@@ -0,0 +1,24 @@
+package spot
+
+import (
+	"testing"
+)
+
+func TestClampedSNR(t *testing.T) {
+	for _, tt := range []struct {
+		snr  int
+		want int8
+	}{
+		{-24, -24},
+		{0, 0},
+		{127, 127},
+		{128, 127},
+		{1000, 127},
+		{-128, -128},
+		{-129, -128},
+	} {
+		if got := ClampedSNR(tt.snr); got != tt.want {
+			t.Errorf("%d: expected %d, got %d", tt.snr, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package spot
+
+import (
+	"github.com/kahara/go-pskreporter-spot/adif"
+	"github.com/kahara/go-pskreporter-spot/callsign"
+	"github.com/kahara/go-pskreporter-spot/maidenhead"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"strings"
+	"sync"
+)
+
+// What a stage of the pipeline did to a spot, for FilterMetric's "action" label
+const (
+	FilterAction_Dropped = "dropped"
+	FilterAction_Changed = "changed"
+)
+
+// Filter tells whether a spot should be sent
+type Filter func(spot *Spot) bool
+
+// Transformer changes a spot before it's sent, such as with Spot.WithMode
+type Transformer func(spot *Spot)
+
+// Stage is a named step of the pipeline Feed runs spots through before queueing them; either a Filter or a Transformer
+type Stage struct {
+	Name        string
+	Filter      Filter
+	Transformer Transformer
+}
+
+// FilterCount is how many spots a stage has dropped, or changed
+type FilterCount struct {
+	Dropped int
+	Changed int
+}
+
+// The stages, in the order they were configured, and what they've done so far
+type pipeline struct {
+	stages []Stage
+	metric *prometheus.CounterVec
+	mutex  sync.Mutex
+	counts map[string]FilterCount
+}
+
+func newPipeline(stages []Stage, metric *prometheus.CounterVec) *pipeline {
+	return &pipeline{
+		stages: stages,
+		metric: metric,
+		counts: make(map[string]FilterCount),
+	}
+}
+
+// Run a spot through every stage, stopping at the first one that drops it
+func (p *pipeline) run(spot *Spot) bool {
+	for _, stage := range p.stages {
+		if stage.Filter != nil {
+			if !stage.Filter(spot) {
+				p.count(stage.Name, FilterAction_Dropped)
+				log.Debug().Str("callsign", spot.sender.Callsign).Str("filter", stage.Name).Msg("Filtered out, dropping spot")
+				return false
+			}
+			continue
+		}
+
+		before := *spot
+		stage.Transformer(spot)
+		if *spot != before {
+			p.count(stage.Name, FilterAction_Changed)
+		}
+	}
+	return true
+}
+
+func (p *pipeline) count(name string, action string) {
+	p.mutex.Lock()
+	count := p.counts[name]
+	if action == FilterAction_Dropped {
+		count.Dropped++
+	} else {
+		count.Changed++
+	}
+	p.counts[name] = count
+	p.mutex.Unlock()
+
+	if p.metric != nil {
+		p.metric.WithLabelValues(name, action).Inc()
+	}
+}
+
+// FilterCounts returns how many spots each stage of the pipeline has dropped or changed, by name
+func (s *Spotter) FilterCounts() map[string]FilterCount {
+	s.pipeline.mutex.Lock()
+	defer s.pipeline.mutex.Unlock()
+
+	counts := make(map[string]FilterCount, len(s.pipeline.counts))
+	for name, count := range s.pipeline.counts {
+		counts[name] = count
+	}
+	return counts
+}
+
+// All lets through spots that every one of filters lets through
+func All(filters ...Filter) Filter {
+	return func(spot *Spot) bool {
+		for _, filter := range filters {
+			if !filter(spot) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Any lets through spots that at least one of filters lets through
+func Any(filters ...Filter) Filter {
+	return func(spot *Spot) bool {
+		for _, filter := range filters {
+			if filter(spot) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not lets through the spots filter doesn't
+func Not(filter Filter) Filter {
+	return func(spot *Spot) bool {
+		return !filter(spot)
+	}
+}
+
+// Frequencies lets through spots on the frequencies filter does, such as bandplan.Worldwide.From("6m")
+func Frequencies(filter func(frequency uint64) bool) Filter {
+	return func(spot *Spot) bool {
+		return filter(spot.frequency)
+	}
+}
+
+// Modes lets through spots of the given modes, which may be ADIF MODEs to match all of their SUBMODEs
+func Modes(modes ...string) Filter {
+	names := make(map[string]bool)
+	for _, mode := range modes {
+		if canonical, ok := adif.CanonicalMode(mode); ok {
+			mode = canonical
+		}
+		names[strings.ToUpper(mode)] = true
+	}
+
+	return func(spot *Spot) bool {
+		if names[strings.ToUpper(spot.mode)] {
+			return true
+		}
+		parent, ok := adif.ParentMode(spot.mode)
+		return ok && names[parent]
+	}
+}
+
+// DropCallsigns drops spots of the given senders, such as the receiver itself or callsigns known to be busted
+// decodes; "K1ABC" also drops "K1ABC/P" and "DL/K1ABC"
+func DropCallsigns(callsigns ...string) Filter {
+	bases := make(map[string]bool)
+	for _, c := range callsigns {
+		bases[baseCallsign(c)] = true
+	}
+
+	return func(spot *Spot) bool {
+		return !bases[baseCallsign(spot.sender.Callsign)]
+	}
+}
+
+// The callsign without prefix or suffix, or failing that, as it is in upper case
+func baseCallsign(c string) string {
+	if base, err := callsign.Base(c); err == nil {
+		return base
+	}
+	return strings.ToUpper(strings.TrimSpace(c))
+}
+
+// Chain runs transformers one after another
+func Chain(transformers ...Transformer) Transformer {
+	return func(spot *Spot) {
+		for _, transformer := range transformers {
+			transformer(spot)
+		}
+	}
+}
+
+// RewriteModes replaces modes, in any case, with others, such as what a decoder calls a mode with what it really is
+func RewriteModes(modes map[string]string) Transformer {
+	rewrites := make(map[string]string, len(modes))
+	for from, to := range modes {
+		rewrites[strings.ToUpper(from)] = to
+	}
+
+	return func(spot *Spot) {
+		if to, found := rewrites[strings.ToUpper(spot.mode)]; found {
+			spot.WithMode(to)
+		}
+	}
+}
+
+// ClampSNR keeps SNRs between min and max, for decoders that report values no one believes
+func ClampSNR(min int8, max int8) Transformer {
+	return func(spot *Spot) {
+		if spot.snr < min {
+			spot.snr = min
+		}
+		if spot.snr > max {
+			spot.snr = max
+		}
+	}
+}
+
+// FillLocator fills in the locator of spots without one, from lookup; see also LocatorCache
+func FillLocator(lookup func(callsign string) string) Transformer {
+	return func(spot *Spot) {
+		if spot.sender.Locator == "" {
+			spot.sender.Locator = lookup(spot.sender.Callsign)
+		}
+	}
+}
+
+// LocatorCache remembers the locators senders have been heard with, to fill in spots that come without one, such
+// as FT8 signal reports
+type LocatorCache struct {
+	mutex    sync.Mutex
+	locators map[string]string
+}
+
+func NewLocatorCache() *LocatorCache {
+	return &LocatorCache{
+		locators: make(map[string]string),
+	}
+}
+
+// Lookup returns the locator callsign was last heard with, or an empty string
+func (c *LocatorCache) Lookup(callsign string) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.locators[strings.ToUpper(callsign)]
+}
+
+// Transform is a Transformer that remembers the locator of a spot that has one, and fills in one that doesn't
+func (c *LocatorCache) Transform(spot *Spot) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := strings.ToUpper(spot.sender.Callsign)
+	if spot.sender.Locator != "" {
+		if maidenhead.Valid(spot.sender.Locator) {
+			c.locators[key] = spot.sender.Locator
+		}
+		return
+	}
+	spot.sender.Locator = c.locators[key]
+}
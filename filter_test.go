@@ -0,0 +1,112 @@
+package spot
+
+import (
+	"github.com/kahara/go-pskreporter-spot/bandplan"
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+)
+
+func TestFilters(t *testing.T) {
+	var (
+		ft8      = NewSpot("DL/K1ABC/P", "", 14074000, -3, 0, "FT8", 1, 0)
+		ft4      = NewSpot("N1CALL", "", 14080000, -3, 0, "FT4", 1, 0)
+		cw       = NewSpot("N2CALL", "", 50090000, 12, 0, "CW", 1, 0)
+		from6m   = Frequencies(bandplan.Worldwide.From("6m"))
+		mfskOrCW = Modes("mfsk", "CW")
+	)
+
+	for _, tt := range []struct {
+		name   string
+		filter Filter
+		want   []bool
+	}{
+		{"drop callsigns", DropCallsigns("k1abc", "N2CALL"), []bool{false, true, false}},
+		{"frequencies", from6m, []bool{false, false, true}},
+		{"modes", Modes("FT8"), []bool{true, false, false}},
+		{"parent modes", mfskOrCW, []bool{false, true, true}},
+		{"all", All(from6m, mfskOrCW), []bool{false, false, true}},
+		{"any", Any(from6m, Modes("FT8")), []bool{true, false, true}},
+		{"not", Not(from6m), []bool{true, true, false}},
+	} {
+		for i, spot := range []*Spot{ft8, ft4, cw} {
+			if got := tt.filter(spot); got != tt.want[i] {
+				t.Errorf("%s: spot %d: expected %v, got %v", tt.name, i, tt.want[i], got)
+			}
+		}
+	}
+}
+
+func TestTransformers(t *testing.T) {
+	cache := NewLocatorCache()
+	cache.Transform(NewSpot("N1CALL", "FN42aa", 14074000, 0, 0, "FT8", 1, 0))
+	cache.Transform(NewSpot("N2CALL", "FN42AAA", 14074000, 0, 0, "FT8", 1, 0)) // Not remembered
+
+	for _, tt := range []struct {
+		name        string
+		transformer Transformer
+		spot        *Spot
+		want        *Spot
+	}{
+		{"rewrite modes", RewriteModes(map[string]string{"mfsk": "JS8"}), NewSpot("N1CALL", "", 7078000, 0, 0, "MFSK", 1, 0), NewSpot("N1CALL", "", 7078000, 0, 0, "JS8", 1, 0)},
+		{"clamp low", ClampSNR(-30, 30), NewSpot("N1CALL", "", 7078000, -128, 0, "FT8", 1, 0), NewSpot("N1CALL", "", 7078000, -30, 0, "FT8", 1, 0)},
+		{"clamp high", ClampSNR(-30, 30), NewSpot("N1CALL", "", 7078000, 99, 0, "FT8", 1, 0), NewSpot("N1CALL", "", 7078000, 30, 0, "FT8", 1, 0)},
+		{"fill locator", FillLocator(func(string) string { return "JJ00og" }), NewSpot("N1CALL", "", 7078000, 0, 0, "FT8", 1, 0), NewSpot("N1CALL", "JJ00og", 7078000, 0, 0, "FT8", 1, 0)},
+		{"locator cache", cache.Transform, NewSpot("n1call", "", 7078000, 0, 0, "FT8", 1, 0), NewSpot("n1call", "FN42aa", 7078000, 0, 0, "FT8", 1, 0)},
+		{"locator cache miss", cache.Transform, NewSpot("N2CALL", "", 7078000, 0, 0, "FT8", 1, 0), NewSpot("N2CALL", "", 7078000, 0, 0, "FT8", 1, 0)},
+		{"chain", Chain(ClampSNR(-30, 30), RewriteModes(map[string]string{"FT8": "FT4"})), NewSpot("N1CALL", "", 7078000, 50, 0, "FT8", 1, 0), NewSpot("N1CALL", "", 7078000, 30, 0, "FT4", 1, 0)},
+	} {
+		tt.transformer(tt.spot)
+		if *tt.spot != *tt.want {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, *tt.want, *tt.spot)
+		}
+	}
+}
+
+func TestSpotterPipeline(t *testing.T) {
+	var (
+		registry = prometheus.NewRegistry()
+		metric   = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "filtered_spots_total"}, []string{"filter", "action"})
+		spotter  = newTestSpotter(t, SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, "",
+			WithFilter("own", DropCallsigns("N0CALL")),
+			WithTransformer("snr", ClampSNR(-30, 30)),
+			WithFilter("busted", DropCallsigns("K1ABC")),
+			WithFilterMetric(metric),
+		)
+	)
+	registry.MustRegister(metric)
+
+	spotter.Feed(NewSpot("N0CALL/P", "", 14074000, -3, 0, "FT8", 1, 0)) // Dropped as our own
+	spotter.Feed(NewSpot("K1ABC", "", 14074000, 40, 0, "FT8", 1, 0))    // Changed, then dropped as busted
+	spotter.Feed(NewSpot("N1CALL", "", 14074000, -40, 0, "FT8", 1, 0))  // Changed
+	spotter.Feed(NewSpot("N2CALL", "", 14074000, -3, 0, "FT8", 1, 0))
+
+	if spotter.queue.len() != 2 {
+		t.Fatalf("expected 2 spots, got %d", spotter.queue.len())
+	}
+	if got := spotter.queue.pop().SNR(); got != -30 {
+		t.Errorf("expected SNR -30, got %d", got)
+	}
+
+	want := map[string]FilterCount{
+		"own":    {Dropped: 1},
+		"snr":    {Changed: 2},
+		"busted": {Dropped: 1},
+	}
+	counts := spotter.FilterCounts()
+	if len(counts) != len(want) {
+		t.Errorf("expected %+v, got %+v", want, counts)
+	}
+	for name, count := range want {
+		if counts[name] != count {
+			t.Errorf("%s: expected %+v, got %+v", name, count, counts[name])
+		}
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 || len(families[0].GetMetric()) != 3 {
+		t.Fatalf("unexpected metrics %+v", families)
+	}
+}
@@ -0,0 +1,188 @@
+// Package fldigi polls fldigi's XML-RPC interface for decoded text and feeds the callsigns it finds into a Spotter
+package fldigi
+
+import (
+	"context"
+	"github.com/kahara/go-pskreporter-spot"
+	"github.com/kahara/go-pskreporter-spot/adif"
+	"github.com/rs/zerolog/log"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultURL      = "http://127.0.0.1:7362/RPC2"
+	PollInterval    = 2 * time.Second
+	Holdoff         = 10 * time.Minute // Don't spot the same callsign on the same mode more often than this
+	MaxLineLength   = 512              // Text without newlines is looked at once there's this much of it
+	DefaultModeName = "PSK"
+)
+
+// Poller asks fldigi for newly decoded text, along with the frequency and mode it was decoded on
+type Poller struct {
+	client       *Client
+	feeder       spot.Feeder
+	heuristics   *Heuristics
+	pollInterval time.Duration
+	tuned        tuning // What the text seen so far was decoded on
+	line         strings.Builder
+	spotted      map[string]time.Time
+	now          func() time.Time
+}
+
+// NewPoller returns a Poller for fldigi at url, such as DefaultURL; heuristics may be nil for DefaultHeuristics
+func NewPoller(url string, feeder spot.Feeder, heuristics *Heuristics) *Poller {
+	if heuristics == nil {
+		heuristics = DefaultHeuristics()
+	}
+
+	return &Poller{
+		client:       NewClient(url),
+		feeder:       feeder,
+		heuristics:   heuristics,
+		pollInterval: PollInterval,
+		spotted:      make(map[string]time.Time),
+		now:          time.Now,
+	}
+}
+
+// Run polls until ctx is done; fldigi not running is logged, and retried on the next poll
+func (p *Poller) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.poll(ctx); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Str("url", p.client.url).Msg("Could not poll fldigi")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// The frequency and mode fldigi is decoding on
+type tuning struct {
+	frequency uint64
+	mode      string
+}
+
+func (p *Poller) poll(ctx context.Context) error {
+	// What fldigi is tuned to is read on both sides of the text, so that text decoded across a band or mode change
+	// isn't attributed to either
+	before, err := p.tuning(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := p.client.Call(ctx, "rx.get_data")
+	if err != nil {
+		return err
+	}
+	text := string(data.AsBytes())
+	after := before
+	if text != "" {
+		if after, err = p.tuning(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Whatever was decoded since the previous poll may span a change, and so may a line left unfinished by it
+	changed := before != after || (p.tuned != tuning{} && p.tuned != before)
+	p.tuned = after
+	if changed {
+		if text != "" || p.line.Len() > 0 {
+			log.Debug().Uint64("frequency", after.frequency).Str("mode", after.mode).Msg("Frequency or mode changed, dropping text decoded across it")
+		}
+		p.line.Reset()
+		return nil
+	}
+
+	p.receive(text, before.frequency, before.mode)
+
+	return nil
+}
+
+func (p *Poller) tuning(ctx context.Context) (tuning, error) {
+	modem, err := p.client.Call(ctx, "modem.get_name")
+	if err != nil {
+		return tuning{}, err
+	}
+	dial, err := p.client.Call(ctx, "main.get_frequency")
+	if err != nil {
+		return tuning{}, err
+	}
+	carrier, err := p.client.Call(ctx, "modem.get_carrier")
+	if err != nil {
+		return tuning{}, err
+	}
+
+	dialFrequency, err := dial.AsFloat()
+	if err != nil {
+		return tuning{}, err
+	}
+	offset, err := carrier.AsFloat()
+	if err != nil {
+		return tuning{}, err
+	}
+
+	return tuning{uint64(dialFrequency + offset), Mode(modem.AsString())}, nil
+}
+
+// Look at text line by line, so that a callsign and grid are only paired when they're sent together
+func (p *Poller) receive(text string, frequency uint64, mode string) {
+	for _, r := range text {
+		if r == '\n' || r == '\r' || p.line.Len() >= MaxLineLength {
+			p.handle(p.line.String(), frequency, mode)
+			p.line.Reset()
+		}
+		if r != '\n' && r != '\r' {
+			p.line.WriteRune(r)
+		}
+	}
+}
+
+func (p *Poller) handle(line string, frequency uint64, mode string) {
+	callsign, grid, ok := p.heuristics.Find(line)
+	if !ok || frequency == 0 {
+		return
+	}
+
+	now := p.now()
+	key := callsign + " " + mode
+	if last, seen := p.spotted[key]; seen && now.Sub(last) < Holdoff {
+		return
+	}
+	p.spotted[key] = now
+
+	// Forget what can't hold anything off anymore
+	for k, last := range p.spotted {
+		if now.Sub(last) >= Holdoff {
+			delete(p.spotted, k)
+		}
+	}
+
+	p.feeder.Feed(spot.NewSpot(callsign, grid, frequency, 0, 0, mode, spot.InformationSource_AutomaticallyExtracted, uint32(now.Unix())))
+}
+
+// Mode turns fldigi's modem name into an ADIF mode or submode, such as BPSK31 into PSK31, or OLIVIA-8-500 into
+// OLIVIA 8/500; variants ADIF doesn't name, such as CONTESTIA-8-500, go by the mode they're a variant of
+func Mode(modem string) string {
+	modem = strings.ToUpper(strings.TrimSpace(modem))
+	if modem == "" {
+		return DefaultModeName
+	}
+
+	if mode, ok := adif.CanonicalMode(modem); ok {
+		return mode
+	}
+	if family, _, found := strings.Cut(modem, "-"); found {
+		if mode, ok := adif.CanonicalMode(family); ok {
+			return mode
+		}
+	}
+
+	return modem
+}
@@ -0,0 +1,132 @@
+package fldigi
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/kahara/go-pskreporter-spot"
+	"github.com/kahara/go-pskreporter-spot/spottest"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A stand-in for fldigi's XML-RPC server, handing out queued RX text
+type fakeFldigi struct {
+	mutex  sync.Mutex
+	rx     []string
+	modem  string
+	dial   float64
+	offset int
+	retune func(f *fakeFldigi) // If set, called once RX text has been handed out, as if the operator changed bands
+}
+
+var methodNamePattern = regexp.MustCompile(`<methodName>([^<]+)</methodName>`)
+
+func (f *fakeFldigi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	m := methodNamePattern.FindSubmatch(body)
+	if m == nil {
+		http.Error(w, "no method", http.StatusBadRequest)
+		return
+	}
+
+	var value string
+	switch string(m[1]) {
+	case "rx.get_data":
+		var data string
+		if len(f.rx) > 0 {
+			data, f.rx = f.rx[0], f.rx[1:]
+		}
+		if f.retune != nil {
+			f.retune(f)
+			f.retune = nil
+		}
+		value = "<base64>" + base64.StdEncoding.EncodeToString([]byte(data)) + "</base64>"
+	case "modem.get_name":
+		value = "<string>" + f.modem + "</string>"
+	case "main.get_frequency":
+		value = fmt.Sprintf("<double>%f</double>", f.dial)
+	case "modem.get_carrier":
+		value = fmt.Sprintf("<i4>%d</i4>", f.offset)
+	default:
+		fmt.Fprintf(w, `<?xml version="1.0"?><methodResponse><fault><value><struct><member><name>faultCode</name><value><int>-1</int></value></member><member><name>faultString</name><value>No such method</value></member></struct></value></fault></methodResponse>`)
+		return
+	}
+	fmt.Fprintf(w, `<?xml version="1.0"?><methodResponse><params><param><value>%s</value></param></params></methodResponse>`, value)
+}
+
+func TestPoller(t *testing.T) {
+	fake := &fakeFldigi{
+		rx: []string{
+			"CQ CQ CQ de K1ABC K1ABC",
+			" K1ABC pse k\nW9XYZ de K1ABC loc FN42 k\n",
+			"",
+			"CQ CQ de OH2A",
+			"BC OH2ABC k\n",
+			"CQ CQ de OH3ABC OH3ABC k\n",
+		},
+		modem:  "BPSK31",
+		dial:   14070000,
+		offset: 1500,
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	var (
+		f      spottest.Feeder
+		poller = NewPoller(server.URL, &f, nil)
+		now    = time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	)
+	poller.now = func() time.Time { return now }
+
+	for i := 0; i < 6; i++ {
+		fake.mutex.Lock()
+		switch i {
+		case 3:
+			// While the text is being read, so none of it can be told apart
+			fake.retune = func(f *fakeFldigi) { f.dial = 14080000 }
+		case 4:
+			// Between polls, so the end of a line started before can't be told apart
+			fake.modem, fake.dial, fake.offset = "OLIVIA-8-500", 7070000, 1000
+		}
+		fake.mutex.Unlock()
+
+		if err := poller.poll(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// K1ABC is held off the second time around, and OH2ABC was decoded across changes
+	want := []*spot.Spot{
+		spot.NewSpot("K1ABC", "", 14071500, 0, 0, "PSK31", spot.InformationSource_AutomaticallyExtracted, uint32(now.Unix())),
+		spot.NewSpot("OH3ABC", "", 7071000, 0, 0, "OLIVIA 8/500", spot.InformationSource_AutomaticallyExtracted, uint32(now.Unix())),
+	}
+	spots := f.Spots()
+	if len(spots) != len(want) {
+		t.Fatalf("expected %d spots, got %+v", len(want), spots)
+	}
+	for i := range want {
+		if *spots[i] != *want[i] {
+			t.Errorf("spot %d: expected %+v, got %+v", i, *want[i], *spots[i])
+		}
+	}
+}
+
+func TestClientFault(t *testing.T) {
+	server := httptest.NewServer(&fakeFldigi{})
+	defer server.Close()
+
+	_, err := NewClient(server.URL).Call(context.Background(), "no.such_method", "text", 1, 2.5)
+	if !errors.Is(err, ErrFault) {
+		t.Errorf("expected %v, got %v", ErrFault, err)
+	}
+}
@@ -0,0 +1,53 @@
+package fldigi
+
+import (
+	"github.com/kahara/go-pskreporter-spot/callsign"
+	"regexp"
+	"strings"
+)
+
+// Heuristics pick callsigns and grids out of free-form decoded text; the first submatch of each pattern is used
+type Heuristics struct {
+	Callsign []*regexp.Regexp
+	Grid     []*regexp.Regexp
+}
+
+// Text is upper-cased before matching
+var (
+	// "CQ CQ DE K1ABC K1ABC", "W9XYZ DE K1ABC KN"
+	Pattern_De = regexp.MustCompile(`\bDE\s+([A-Z0-9/]*[0-9][A-Z0-9/]*[A-Z])\b`)
+	// "CQ CQ K1ABC K1ABC K"
+	Pattern_CQ = regexp.MustCompile(`\bCQ\s+(?:CQ\s+)*(?:DX\s+)?([A-Z0-9/]*[0-9][A-Z0-9/]*[A-Z])\b`)
+	// "LOC FN42AA", "QRA: FN42", "GRID IS FN42"
+	Pattern_Grid = regexp.MustCompile(`\b(?:LOC|LOCATOR|QRA|GRID)(?:\s+IS)?\s*:?\s*([A-R]{2}[0-9]{2}(?:[A-X]{2})?)\b`)
+)
+
+func DefaultHeuristics() *Heuristics {
+	return &Heuristics{
+		Callsign: []*regexp.Regexp{Pattern_De, Pattern_CQ},
+		Grid:     []*regexp.Regexp{Pattern_Grid},
+	}
+}
+
+// Find returns the sender's callsign and grid, if a line of text gives them away
+func (h *Heuristics) Find(line string) (call string, grid string, ok bool) {
+	line = strings.ToUpper(line)
+
+	// Garbled text easily matches a pattern, so it has to look like a real callsign too
+	call = firstSubmatch(h.Callsign, line)
+	if !callsign.Valid(call) {
+		return "", "", false
+	}
+	grid = firstSubmatch(h.Grid, line)
+
+	return call, grid, true
+}
+
+func firstSubmatch(patterns []*regexp.Regexp, line string) string {
+	for _, pattern := range patterns {
+		if m := pattern.FindStringSubmatch(line); len(m) > 1 {
+			return m[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package fldigi
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestHeuristics(t *testing.T) {
+	for _, tt := range []struct {
+		line     string
+		callsign string
+		grid     string
+		ok       bool
+	}{
+		{"CQ CQ CQ de K1ABC K1ABC K1ABC pse k", "K1ABC", "", true},
+		{"cq cq oh2abc/p oh2abc/p k", "OH2ABC/P", "", true},
+		{"W9XYZ de K1ABC - name Bob, QTH Boston, loc FN42aa - W9XYZ de K1ABC kn", "K1ABC", "FN42AA", true},
+		{"CQ DX de PY2XYZ PY2XYZ grid is GG66 pse k", "PY2XYZ", "GG66", true},
+		{"tnx fer QSO, 73 and gl", "", "", false},
+		{"e5tn eie de 3", "", "", false},
+		{"CQ CQ de W1XYZABCQ k", "", "", false}, // Garbled, but would pass for a callsign by its letters and digits alone
+	} {
+		t.Run(tt.line, func(t *testing.T) {
+			callsign, grid, ok := DefaultHeuristics().Find(tt.line)
+			if callsign != tt.callsign || grid != tt.grid || ok != tt.ok {
+				t.Errorf("expected %q %q %v, got %q %q %v", tt.callsign, tt.grid, tt.ok, callsign, grid, ok)
+			}
+		})
+	}
+
+	// Custom heuristics, for a net where stations check in with "QRZ CALL"
+	heuristics := &Heuristics{Callsign: []*regexp.Regexp{regexp.MustCompile(`\bQRZ\s+([A-Z0-9/]+)`)}}
+	if callsign, _, ok := heuristics.Find("qrz w1aw"); !ok || callsign != "W1AW" {
+		t.Errorf("unexpected %q %v", callsign, ok)
+	}
+}
+
+func TestMode(t *testing.T) {
+	for modem, want := range map[string]string{
+		"BPSK31":          "PSK31",
+		"BPSK1000":        "PSK1000",
+		"QPSK63":          "QPSK63",
+		"RTTY":            "RTTY",
+		"OLIVIA-8-500":    "OLIVIA 8/500",
+		"OLIVIA-16-250":   "OLIVIA",
+		"Contestia-4-250": "CONTESTI",
+		"CONTESTIA-64-2K": "CONTESTI",
+		"DOMX22":          "DOMX22",
+		"":                "PSK",
+	} {
+		if got := Mode(modem); got != want {
+			t.Errorf("%q: expected %q, got %q", modem, want, got)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package fldigi
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrFault    = errors.New("XML-RPC fault")
+	ErrResponse = errors.New("unexpected XML-RPC response")
+)
+
+// Client is just enough of an XML-RPC client for fldigi's methods, which take and return scalars
+type Client struct {
+	url  string
+	http *http.Client
+}
+
+func NewClient(url string) *Client {
+	return &Client{
+		url:  url,
+		http: &http.Client{},
+	}
+}
+
+// Value is a scalar returned by a call
+type Value struct {
+	Int     *string `xml:"int"`
+	I4      *string `xml:"i4"`
+	Double  *string `xml:"double"`
+	String  *string `xml:"string"`
+	Base64  *string `xml:"base64"`
+	Text    string  `xml:",chardata"` // A value without a type is a string
+	Members []struct {
+		Name  string `xml:"name"`
+		Value Value  `xml:"value"`
+	} `xml:"struct>member"`
+}
+
+type methodResponse struct {
+	Params []struct {
+		Value Value `xml:"value"`
+	} `xml:"params>param"`
+	Fault *struct {
+		Value Value `xml:"value"`
+	} `xml:"fault"`
+}
+
+// Call invokes a method with string, int or float64 parameters
+func (c *Client) Call(ctx context.Context, method string, params ...interface{}) (*Value, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?><methodCall><methodName>`)
+	_ = xml.EscapeText(&body, []byte(method))
+	body.WriteString(`</methodName><params>`)
+	for _, param := range params {
+		body.WriteString(`<param><value>`)
+		switch p := param.(type) {
+		case string:
+			body.WriteString(`<string>`)
+			_ = xml.EscapeText(&body, []byte(p))
+			body.WriteString(`</string>`)
+		case int:
+			fmt.Fprintf(&body, `<int>%d</int>`, p)
+		case float64:
+			fmt.Fprintf(&body, `<double>%s</double>`, strconv.FormatFloat(p, 'f', -1, 64))
+		default:
+			return nil, fmt.Errorf("unsupported parameter type %T", param)
+		}
+		body.WriteString(`</value></param>`)
+	}
+	body.WriteString(`</params></methodCall>`)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, &body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "text/xml")
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, response.Body)
+		return nil, fmt.Errorf("%w: %s from %s", ErrResponse, response.Status, method)
+	}
+
+	var decoded methodResponse
+	if err = xml.NewDecoder(response.Body).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrResponse, err)
+	}
+	if decoded.Fault != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrFault, method, decoded.Fault.Value.member("faultString").AsString())
+	}
+	if len(decoded.Params) == 0 {
+		// Methods returning nothing still return an empty value
+		return &Value{}, nil
+	}
+
+	return &decoded.Params[0].Value, nil
+}
+
+func (v *Value) member(name string) *Value {
+	for i := range v.Members {
+		if v.Members[i].Name == name {
+			return &v.Members[i].Value
+		}
+	}
+	return &Value{}
+}
+
+func (v *Value) AsString() string {
+	switch {
+	case v.String != nil:
+		return *v.String
+	case v.Int != nil:
+		return *v.Int
+	case v.I4 != nil:
+		return *v.I4
+	case v.Double != nil:
+		return *v.Double
+	case v.Base64 != nil:
+		return string(v.AsBytes())
+	}
+	return v.Text
+}
+
+func (v *Value) AsFloat() (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(v.AsString()), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrResponse, err)
+	}
+	return f, nil
+}
+
+func (v *Value) AsBytes() []byte {
+	if v.Base64 == nil {
+		return []byte(v.AsString())
+	}
+
+	b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(*v.Base64), ""))
+	if err != nil {
+		return nil
+	}
+	return b
+}
@@ -0,0 +1,120 @@
+// Package gpsd follows the receiver's position through gpsd's JSON protocol and turns it into a Maidenhead locator
+//
+// A Client is a spot.LocatorProvider, for receivers on the move.
+package gpsd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/kahara/go-pskreporter-spot"
+	"github.com/kahara/go-pskreporter-spot/maidenhead"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAddress = "127.0.0.1:2947"
+	MaxAge         = time.Minute // How long a fix is trusted without a fresh one
+	ReconnectDelay = 5 * time.Second
+	DefaultLength  = 6 // Characters in a locator; 8 narrows it down to about 1 km
+)
+
+// Mode_* are the fix modes of a TPV report
+const (
+	Mode_Unknown = iota
+	Mode_NoFix
+	Mode_2D
+	Mode_3D
+)
+
+var watch = []byte(`?WATCH={"enable":true,"json":true};` + "\n")
+
+// Report is the part of a gpsd report that matters here
+type Report struct {
+	Class string   `json:"class"`
+	Mode  int      `json:"mode"`
+	Lat   *float64 `json:"lat"`
+	Lon   *float64 `json:"lon"`
+}
+
+// Client watches gpsd over TCP, reconnecting when the receiver or gpsd goes away
+type Client struct {
+	address        string
+	length         int
+	reconnectDelay time.Duration
+	mutex          sync.Mutex
+	locator        string
+	updated        time.Time
+	now            func() time.Time
+}
+
+// NewClient returns a Client for gpsd at address, such as DefaultAddress, giving locators of length characters
+func NewClient(address string, length int) *Client {
+	if length != 6 && length != 8 {
+		length = DefaultLength
+	}
+
+	return &Client{
+		address:        address,
+		length:         length,
+		reconnectDelay: ReconnectDelay,
+		now:            time.Now,
+	}
+}
+
+// Locator returns the locator of the latest fix, unless there hasn't been one in MaxAge
+func (c *Client) Locator() (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.updated.IsZero() || c.now().Sub(c.updated) > MaxAge {
+		return "", false
+	}
+	return c.locator, true
+}
+
+// Run watches until ctx is done
+func (c *Client) Run(ctx context.Context) error {
+	return spot.Redial(ctx, "gpsd", c.address, c.reconnectDelay, c.serve)
+}
+
+func (c *Client) serve(conn net.Conn) error {
+	if _, err := conn.Write(watch); err != nil {
+		return err
+	}
+
+	// gpsd sends one JSON object per line: VERSION first, then DEVICES and WATCH, then a TPV for every fix
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var report Report
+		if err := json.Unmarshal(scanner.Bytes(), &report); err != nil {
+			log.Debug().Err(err).Msg("Skipping unparseable gpsd report")
+			continue
+		}
+		c.handle(&report)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+func (c *Client) handle(report *Report) {
+	if report.Class != "TPV" || report.Mode < Mode_2D || report.Lat == nil || report.Lon == nil {
+		return
+	}
+
+	locator, err := maidenhead.FromLatLon(*report.Lat, *report.Lon, c.length)
+	if err != nil {
+		log.Debug().Err(err).Msg("Skipping fix")
+		return
+	}
+
+	c.mutex.Lock()
+	c.locator, c.updated = locator, c.now()
+	c.mutex.Unlock()
+}
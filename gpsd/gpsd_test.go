@@ -0,0 +1,95 @@
+package gpsd
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A stand-in for gpsd, which sends whatever reports it's given once watched
+func fakeGpsd(t *testing.T, listener net.Listener, reports <-chan string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	_, _ = conn.Write([]byte(`{"class":"VERSION","release":"3.25","rev":"3.25","proto_major":3,"proto_minor":15}` + "\n"))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	if !strings.HasPrefix(line, "?WATCH=") {
+		t.Errorf("unexpected command %q", line)
+	}
+
+	for report := range reports {
+		if _, err = conn.Write([]byte(report + "\n")); err != nil {
+			return
+		}
+	}
+}
+
+func waitFor(client *Client, locator string) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if got, ok := client.Locator(); ok && got == locator {
+			return true
+		}
+	}
+	return false
+}
+
+func TestClient(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	reports := make(chan string, 8)
+	defer close(reports)
+	go fakeGpsd(t, listener, reports)
+
+	var (
+		client      = NewClient(listener.Addr().String(), 8)
+		ctx, cancel = context.WithCancel(context.Background())
+		stopped     = make(chan bool)
+	)
+	go func() {
+		_ = client.Run(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	// Without a fix there's no telling where the receiver is
+	reports <- `{"class":"TPV","device":"/dev/ttyACM0","mode":1}`
+	reports <- `{"class":"SKY","device":"/dev/ttyACM0","satellites":[]}`
+	if _, ok := client.Locator(); ok {
+		t.Error("expected no locator before a fix")
+	}
+
+	reports <- `{"class":"TPV","device":"/dev/ttyACM0","mode":3,"time":"2026-10-17T12:00:00.000Z","lat":60.17,"lon":24.94,"alt":12.5}`
+	if !waitFor(client, "KP20le20") {
+		t.Fatal("fix was not noticed")
+	}
+
+	// Under way
+	reports <- `{"class":"TPV","device":"/dev/ttyACM0","mode":2,"lat":59.44,"lon":24.75}`
+	if !waitFor(client, "KO29jk05") {
+		t.Error("move was not noticed")
+	}
+
+	// A fix that's gone stale is no good
+	client.mutex.Lock()
+	client.now = func() time.Time { return time.Now().Add(2 * MaxAge) }
+	client.mutex.Unlock()
+	if _, ok := client.Locator(); ok {
+		t.Error("expected a stale fix to be ignored")
+	}
+}
@@ -0,0 +1,41 @@
+package spot
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dchest/uniuri"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadPersistentIdentifier reads a 30351.12 "persistentIdentifier" from path,
+// generating and storing a new one if the file doesn't exist yet
+func LoadPersistentIdentifier(path string) (string, error) {
+	contents, err := os.ReadFile(path)
+	if err == nil {
+		identifier := strings.TrimSpace(string(contents))
+		if identifier == "" || len(identifier) > MaxStringLength {
+			return "", fmt.Errorf("%w: persistent identifier in %s", ErrConfig, path)
+		}
+		return identifier, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	identifier := uniuri.New()
+
+	// Write it out in one go, so that a crash can't leave half an identifier behind
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	temporary := path + ".tmp"
+	if err = os.WriteFile(temporary, []byte(identifier+"\n"), 0o600); err != nil {
+		return "", err
+	}
+	if err = os.Rename(temporary, path); err != nil {
+		return "", err
+	}
+
+	return identifier, nil
+}
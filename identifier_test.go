@@ -0,0 +1,35 @@
+package spot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPersistentIdentifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "identifier")
+
+	first, err := LoadPersistentIdentifier(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == "" {
+		t.Fatal("expected an identifier to be generated")
+	}
+
+	second, err := LoadPersistentIdentifier(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("expected %q to be reused, got %q", first, second)
+	}
+
+	if err = os.WriteFile(path, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadPersistentIdentifier(path); !errors.Is(err, ErrConfig) {
+		t.Errorf("expected %v, got %v", ErrConfig, err)
+	}
+}
@@ -9,9 +9,8 @@ import (
 // See https://pskreporter.info/pskdev.html
 
 const (
-	HeaderLength = 16
-	// TODO figure out what is the "theoretical" maximum size of sender record,
-	// TODO for making the decision to get an item from the queue
+	HeaderLength    = 16
+	MaxStringLength = 254 // Longest string that fits behind a single-byte length prefix; receiver fields are held to this
 )
 
 var (
@@ -19,59 +18,15 @@ var (
 	ReceiverRecordHeader = []byte{0x99, 0x92} // "Set ID" in RFC 5101(?)
 	SenderRecordHeader   = []byte{0x99, 0x93}
 
-	ReceiverDescriptor_CallsignLocatorSoftware = []byte{
-		0x00, 0x03, 0x00, 0x24, 0x99, 0x92, 0x00, 0x03, 0x00, 0x00,
-		0x80, 0x02, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x04, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x08, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x00, 0x00,
-	}
-	ReceiverDescriptor_CallsignLocatorSoftwareAntenna = []byte{
-		0x00, 0x03, 0x00, 0x2C, 0x99, 0x92, 0x00, 0x04, 0x00, 0x00,
-		0x80, 0x02, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x04, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x08, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x09, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x00, 0x00,
-	}
-	SenderDescriptor_CallsignFrequencyModeSourceFlowstart = []byte{
-		0x00, 0x02, 0x00, 0x2C, 0x99, 0x93, 0x00, 0x05,
-		0x80, 0x01, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x05, 0x00, 0x04, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x0A, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x0B, 0x00, 0x01, 0x00, 0x00, 0x76, 0x8F,
-		0x00, 0x96, 0x00, 0x04,
-	}
-	SenderDescriptor_CallsignFrequencyModeSourceLocatorFlowstart = []byte{
-		0x00, 0x02, 0x00, 0x34, 0x99, 0x93, 0x00, 0x06,
-		0x80, 0x01, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x05, 0x00, 0x04, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x0A, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x0B, 0x00, 0x01, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x03, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x00, 0x96, 0x00, 0x04,
-	}
-	SenderDescriptor_CallsignFrequencySNRIMDModeSourceFlowstart = []byte{
-		0x00, 0x02, 0x00, 0x3C, 0x99, 0x93, 0x00, 0x07,
-		0x80, 0x01, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x05, 0x00, 0x04, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x06, 0x00, 0x01, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x07, 0x00, 0x01, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x0A, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x0B, 0x00, 0x01, 0x00, 0x00, 0x76, 0x8F,
-		0x00, 0x96, 0x00, 0x04,
-	}
-	SenderDescriptor_CallsignFrequencySNRIMDModeSourceLocatorFlowstart = []byte{
-		0x00, 0x02, 0x00, 0x44, 0x99, 0x93, 0x00, 0x08,
-		0x80, 0x01, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x05, 0x00, 0x04, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x06, 0x00, 0x01, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x07, 0x00, 0x01, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x0A, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x0B, 0x00, 0x01, 0x00, 0x00, 0x76, 0x8F,
-		0x80, 0x03, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
-		0x00, 0x96, 0x00, 0x04,
-	}
+	// See template.go for what's in these
+	ReceiverDescriptor_CallsignLocatorSoftware                         = ReceiverTemplate_CallsignLocatorSoftware.Bytes()
+	ReceiverDescriptor_CallsignLocatorSoftwareAntenna                  = ReceiverTemplate_CallsignLocatorSoftwareAntenna.Bytes()
+	ReceiverDescriptor_CallsignLocatorSoftwareIdentifier               = ReceiverTemplate_CallsignLocatorSoftwareIdentifier.Bytes()
+	ReceiverDescriptor_CallsignLocatorSoftwareAntennaIdentifier        = ReceiverTemplate_CallsignLocatorSoftwareAntennaIdentifier.Bytes()
+	SenderDescriptor_CallsignFrequencyModeSourceFlowstart              = SenderTemplate_CallsignFrequencyModeSourceFlowstart.Bytes()
+	SenderDescriptor_CallsignFrequencyModeSourceLocatorFlowstart       = SenderTemplate_CallsignFrequencyModeSourceLocatorFlowstart.Bytes()
+	SenderDescriptor_CallsignFrequencySNRIMDModeSourceFlowstart        = SenderTemplate_CallsignFrequencySNRIMDModeSourceFlowstart.Bytes()
+	SenderDescriptor_CallsignFrequencySNRIMDModeSourceLocatorFlowstart = SenderTemplate_CallsignFrequencySNRIMDModeSourceLocatorFlowstart.Bytes()
 )
 
 func IPFIX(sequenceNumber uint32, observationDomain uint32, descriptors []byte, records []byte) []byte {
@@ -101,7 +56,14 @@ func IPFIXDescriptors(spotter *Spotter) []byte {
 }
 
 func IPFIXRecords(spotter *Spotter, spent int) []byte {
+	records, _ := ipfixRecords(spotter, spent)
+	return records
+}
+
+// Also returns the spots taken from the queue, so that they can be put back if sending fails
+func ipfixRecords(spotter *Spotter, spent int) ([]byte, []*Spot) {
 	var (
+		spots            []*Spot
 		records          []byte
 		payloadBytesLeft = spotter.maxPayloadBytes - spent - 3 - 3 // Leave margin for paddings, too
 		header           [4]byte
@@ -111,25 +73,19 @@ func IPFIXRecords(spotter *Spotter, spent int) []byte {
 		padding          = 0
 	)
 
-	// Receiver record; callsign, locator, decoderSoftware, (optionally) antennaInformation
-	// FIXME limit the strings' lengths
-	receiverRecord = append(receiverRecord, uint8(len(spotter.receiver.Callsign)))
-	receiverRecord = append(receiverRecord, []byte(spotter.receiver.Callsign)...)
-	receiverRecord = append(receiverRecord, uint8(len(spotter.receiver.Locator)))
-	receiverRecord = append(receiverRecord, []byte(spotter.receiver.Locator)...)
-	receiverRecord = append(receiverRecord, uint8(len(spotter.decoderSoftware)))
-	receiverRecord = append(receiverRecord, []byte(spotter.decoderSoftware)...)
-	if spotter.antennaInformation != "" {
-		receiverRecord = append(receiverRecord, uint8(len(spotter.antennaInformation)))
-		receiverRecord = append(receiverRecord, []byte(spotter.antennaInformation)...)
+	// Receiver record, with whatever fields the receiver template has; a message only carries spots fed under the same
+	// receiver, which may have been changed since
+	receiver := spotter.Receiver()
+	if next := spotter.queue.peek(); next != nil {
+		receiver = next.receiver
 	}
+	receiverRecord = spotter.receiverTemplate.appendRecord(receiverRecord, spotter.receiverFieldValue(receiver))
 
 	length = len(header) + len(receiverRecord)
 	padding = 4 - (length % 4)
 	length += padding
 
-	header[0] = ReceiverRecordHeader[0]
-	header[1] = ReceiverRecordHeader[1]
+	binary.BigEndian.PutUint16(header[0:], spotter.receiverTemplate.ID)
 	binary.BigEndian.PutUint16(header[2:], uint16(length))
 	records = append(records, header[:]...)
 	records = append(records, receiverRecord...)
@@ -141,66 +97,50 @@ func IPFIXRecords(spotter *Spotter, spent int) []byte {
 
 	payloadBytesLeft = payloadBytesLeft - length
 
+	// What a message without descriptors has room for; a sender record bigger than this can never be sent
+	senderBytesMax := spotter.maxPayloadBytes - HeaderLength - 3 - 3 - length
+
 	// Sender records
 Senders:
 	for {
 		var (
 			spot         *Spot
 			senderRecord []byte
+			tooBig       bool
 		)
 
-		select {
-		case s := <-spotter.queue:
-			spot = s
-			log.Info().Msgf("%+v", spot)
-		default:
+		// Take the next spot only if its sender record fits, leaving it at the front of the queue for the next message
+		// otherwise; spots fed under another receiver go in a message of their own
+		spot = spotter.queue.popIf(func(spot *Spot) bool {
+			if spot.receiver != receiver {
+				return false
+			}
+			// Sender record, with whatever fields the sender template has
+			senderRecord = spotter.senderTemplate.appendRecord(nil, spot.fieldValue)
+			tooBig = len(header)+len(senderRecord) > senderBytesMax
+			return tooBig || len(header)+len(senderRecords)+len(senderRecord) <= payloadBytesLeft
+		})
+		if spot == nil {
 			break Senders
 		}
 
-		// Callsign and frequency
-		senderRecord = append(senderRecord, uint8(len(spot.sender.Callsign)))
-		senderRecord = append(senderRecord, []byte(spot.sender.Callsign)...)
-		senderRecord = append(senderRecord, []byte{0, 0, 0, 0}...)
-		binary.BigEndian.PutUint32(senderRecord[len(senderRecord)-4:], uint32(spot.frequency))
-
-		// Add noise and distortion if these are supposed to be available
-		if spotter.spotKind == SpotKind_CallsignFrequencySNRIMDModeSourceFlowstart || spotter.spotKind == SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart {
-			senderRecord = append(senderRecord, byte(spot.snr))
-			senderRecord = append(senderRecord, byte(spot.imd))
-		}
-
-		// Mode and source
-		senderRecord = append(senderRecord, uint8(len(spot.mode)))
-		senderRecord = append(senderRecord, []byte(spot.mode)...)
-		senderRecord = append(senderRecord, byte(spot.informationSource))
-
-		// Locator
-		if spotter.spotKind == SpotKind_CallsignFrequencyModeSourceLocatorFlowstart || spotter.spotKind == SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart {
-			senderRecord = append(senderRecord, uint8(len(spot.sender.Locator)))
-			senderRecord = append(senderRecord, []byte(spot.sender.Locator)...)
+		// Left at the front of the queue, it would hold up every spot behind it for good
+		if tooBig {
+			log.Warn().Str("callsign", spot.sender.Callsign).Int("bytes", len(senderRecord)).Msg("Spot doesn't fit in a message, dropping")
+			spotter.overflow(spot)
+			continue
 		}
 
-		// Beginning of transmission
-		senderRecord = append(senderRecord, []byte{0, 0, 0, 0}...)
-		binary.BigEndian.PutUint32(senderRecord[len(senderRecord)-4:], spot.flowStartSeconds)
-
-		// If it starts to look like adding more would make the packet's size go over MTU, put the spot back into queue
-		// TODO see comment about "theoretical" maximum size of sender record earlier in the file; this could be smarter
-		if (len(header) + len(senderRecords)) > payloadBytesLeft {
-			spotter.queue <- spot
-			log.Info().Msg("skipping")
-			break Senders
-		} else {
-			senderRecords = append(senderRecords, senderRecord...)
-		}
+		senderRecords = append(senderRecords, senderRecord...)
+		spots = append(spots, spot)
+		log.Info().Msgf("%+v", spot)
 	}
 
 	length = len(header) + len(senderRecords)
 	padding = 4 - (length % 4)
 	length += padding
 
-	header[0] = SenderRecordHeader[0]
-	header[1] = SenderRecordHeader[1]
+	binary.BigEndian.PutUint16(header[0:], spotter.senderTemplate.ID)
 	binary.BigEndian.PutUint16(header[2:], uint16(length))
 	records = append(records, header[:]...)
 	records = append(records, senderRecords...)
@@ -210,5 +150,5 @@ Senders:
 		records = append(records, 0)
 	}
 
-	return records
+	return records, spots
 }
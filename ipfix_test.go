@@ -1,7 +1,236 @@
 package spot
 
-import "testing"
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A Spotter that hasn't been started, so that IPFIXRecords can be called directly
+func newTestSpotter(t *testing.T, spotKind int, antennaInformation string, options ...Option) *Spotter {
+	t.Helper()
+
+	config := validConfig()
+	config.SpotKind = spotKind
+	config.AntennaInformation = antennaInformation
+	config.PersistentIdentifier = "h3Wk9zqVbE1xFwYo"
+	config.MaxPayloadBytes = IPv4MaxPayloadBytes
+
+	spotter, err := NewSpotterFromConfig(config, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return spotter
+}
 
 func TestIPFIX(t *testing.T) {
-	t.Logf("FIXME implement the test")
+	var (
+		flowStart = uint32(time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC).Unix())
+		spots     = []*Spot{
+			NewSpot("N1CALL", "II00OG", 50313650, -3, 2, "FT8", 1, flowStart),
+			NewSpot("OH2ABC/P", "KP20", 14074000, 12, 0, "FT4", 1, flowStart+15),
+			NewSpot("K1ABC", "FN42aa", 7074000, -21, 7, "FT8", 1, flowStart+30),
+		}
+	)
+
+	for _, tt := range []struct {
+		name               string
+		spotKind           int
+		antennaInformation string
+		locators           bool
+		snrIMD             bool
+	}{
+		{"CallsignFrequencyModeSourceFlowstart", SpotKind_CallsignFrequencyModeSourceFlowstart, "", false, false},
+		{"CallsignFrequencyModeSourceLocatorFlowstart", SpotKind_CallsignFrequencyModeSourceLocatorFlowstart, "Dipole", true, false},
+		{"CallsignFrequencySNRIMDModeSourceFlowstart", SpotKind_CallsignFrequencySNRIMDModeSourceFlowstart, "", false, true},
+		{"CallsignFrequencySNRIMDModeSourceLocatorFlowstart", SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, "Dipole", true, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			spotter := newTestSpotter(t, tt.spotKind, tt.antennaInformation)
+			for _, spot := range spots {
+				spotter.Feed(spot)
+			}
+
+			descriptors := IPFIXDescriptors(spotter)
+			datagram := IPFIX(42, 0xDEADBEEF, descriptors, IPFIXRecords(spotter, len(descriptors)+HeaderLength))
+
+			message, err := NewDecoder().Decode(datagram)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if message.SequenceNumber != 42 || message.ObservationDomain != 0xDEADBEEF {
+				t.Errorf("unexpected header %+v", message)
+			}
+			if len(message.Templates) != 2 {
+				t.Errorf("expected 2 templates, got %d", len(message.Templates))
+			}
+
+			if len(message.Receivers) != 1 {
+				t.Fatalf("expected 1 receiver, got %d", len(message.Receivers))
+			}
+			receiver := message.Receivers[0]
+			if receiver.Station != spotter.receiver || receiver.DecoderSoftware != spotter.decoderSoftware || receiver.AntennaInformation != tt.antennaInformation || receiver.PersistentIdentifier != spotter.persistentIdentifier {
+				t.Errorf("unexpected receiver %+v", receiver)
+			}
+
+			if len(message.Spots) != len(spots) {
+				t.Fatalf("expected %d spots, got %d", len(spots), len(message.Spots))
+			}
+			for i, got := range message.Spots {
+				want := *spots[i]
+				if !tt.locators {
+					want.sender.Locator = ""
+				}
+				if !tt.snrIMD {
+					want.snr, want.imd = 0, 0
+				}
+				if *got != want {
+					t.Errorf("spot %d: expected %+v, got %+v", i, want, *got)
+				}
+			}
+		})
+	}
+}
+
+func TestIPFIXWithoutDescriptors(t *testing.T) {
+	var (
+		decoder = NewDecoder()
+		spotter = newTestSpotter(t, SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, "")
+	)
+
+	// Records can't be decoded before the templates have been seen...
+	spotter.Feed(NewSpot("N1CALL", "II00OG", 50313650, -3, 2, "FT8", 1, 0))
+	_, err := decoder.Decode(IPFIX(0, 1, nil, IPFIXRecords(spotter, HeaderLength)))
+	if err == nil {
+		t.Fatal("expected an error for unknown templates")
+	}
+
+	// ...but after that they can
+	descriptors := IPFIXDescriptors(spotter)
+	if _, err = decoder.Decode(IPFIX(1, 1, descriptors, IPFIXRecords(spotter, len(descriptors)+HeaderLength))); err != nil {
+		t.Fatal(err)
+	}
+	spotter.Feed(NewSpot("N2CALL", "II00OG", 50313650, -3, 2, "FT8", 1, 0))
+	message, err := decoder.Decode(IPFIX(2, 1, nil, IPFIXRecords(spotter, HeaderLength)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(message.Spots) != 1 || message.Spots[0].Sender().Callsign != "N2CALL" {
+		t.Errorf("unexpected spots %+v", message.Spots)
+	}
+
+	// Templates are per observation domain
+	spotter.Feed(NewSpot("N3CALL", "II00OG", 50313650, -3, 2, "FT8", 1, 0))
+	if _, err = decoder.Decode(IPFIX(0, 2, nil, IPFIXRecords(spotter, HeaderLength))); err == nil {
+		t.Error("expected an error for another observation domain")
+	}
+}
+
+func TestIPFIXExtendedFields(t *testing.T) {
+	senderFields := append(SenderFields(SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart), Field_SenderDXCCADIF, Field_SenderRegion)
+	spotter := newTestSpotter(t, SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, "", WithFields(nil, senderFields), WithRigInformation("IC-7300"), WithLocatorLookup(func(callsign string) string {
+		if callsign == "W1AW" {
+			return "FN31pr"
+		}
+		return ""
+	}))
+
+	spotter.Feed(NewSpot("W1AW", "", 14074000, -8, 0, "FT8", 1, 1670000000).WithDXCC(291).WithRegion("CT"))
+	spotter.Feed(NewSpot("N1CALL", "", 14074000, -8, 0, "FT8", 1, 1670000000))
+
+	descriptors := IPFIXDescriptors(spotter)
+	message, err := NewDecoder().Decode(IPFIX(0, 0, descriptors, IPFIXRecords(spotter, len(descriptors)+HeaderLength)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(message.Receivers) != 1 || message.Receivers[0].RigInformation != "IC-7300" {
+		t.Errorf("unexpected receivers %+v", message.Receivers)
+	}
+	if len(message.Spots) != 2 {
+		t.Fatalf("expected 2 spots, got %d", len(message.Spots))
+	}
+	if got := message.Spots[0]; got.Sender().Locator != "FN31pr" || got.DXCC() != 291 || got.Region() != "CT" {
+		t.Errorf("unexpected spot %+v", got)
+	}
+	if got := message.Spots[1]; got.Sender().Locator != "" || got.DXCC() != 0 || got.Region() != "" {
+		t.Errorf("unexpected spot %+v", got)
+	}
+	if counts := spotter.FilterCounts(); counts["locator"] != (FilterCount{Changed: 1}) {
+		t.Errorf("expected the locator stage to have changed 1 spot, got %+v", counts)
+	}
+}
+
+func TestIPFIXRecordsOrder(t *testing.T) {
+	var (
+		decoder     = NewDecoder()
+		spotter     = newTestSpotter(t, SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, "", WithMaxPayloadBytes(MinPayloadBytes))
+		descriptors = IPFIXDescriptors(spotter)
+		want        []uint32
+	)
+
+	// Fed out of order, as when several decoders feed the same Spotter
+	for i := 0; i < 30; i++ {
+		flowStartSeconds := uint32(1000 + i - 5*(i%3))
+		spotter.Feed(NewSpot("N1CALL", "II00og", 50313650, -3, 2, "FT8", 1, flowStartSeconds))
+		want = append(want, flowStartSeconds)
+	}
+	sort.SliceStable(want, func(i, j int) bool { return want[i] < want[j] })
+
+	// More than fits in one message, so each one leaves the rest at the front of the queue
+	var got []uint32
+	for i := uint32(0); spotter.queue.len() > 0; i++ {
+		message, err := decoder.Decode(IPFIX(i, 1, descriptors, IPFIXRecords(spotter, len(descriptors)+HeaderLength)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(message.Spots) == 0 || len(message.Spots) == len(want) {
+			t.Fatalf("expected some but not all spots in message %d, got %d", i, len(message.Spots))
+		}
+		for _, spot := range message.Spots {
+			got = append(got, spot.FlowStartSeconds())
+		}
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("expected %d spots, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("spot %d: expected %d, got %d", i, want[i], got[i])
+		}
+	}
+}
+
+func TestIPFIXRecordsTooBig(t *testing.T) {
+	var (
+		decoder     = NewDecoder()
+		spotter     = newTestSpotter(t, SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, "", WithMaxPayloadBytes(MinPayloadBytes))
+		descriptors = IPFIXDescriptors(spotter)
+		long        = strings.Repeat("X", MinPayloadBytes/2)
+	)
+
+	// Longer than can be sent at all
+	spotter.Feed(NewSpot("N1CALL", "II00og", 50313650, -3, 2, strings.Repeat("X", MinPayloadBytes+1), 1, 1000))
+	if spotter.queue.len() != 0 {
+		t.Fatalf("expected a spot with a field too long to be dropped, got %d queued", spotter.queue.len())
+	}
+
+	// Every field can be sent, but together they don't fit in any message, so the spot must not hold up the next one
+	spotter.Feed(NewSpot(long, "II00og", 50313650, -3, 2, long, 1, 1000))
+	spotter.Feed(NewSpot("N1CALL", "II00og", 50313650, -3, 2, "FT8", 1, 1001))
+
+	message, err := decoder.Decode(IPFIX(0, 1, descriptors, IPFIXRecords(spotter, len(descriptors)+HeaderLength)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(message.Spots) != 1 || message.Spots[0].Sender().Callsign != "N1CALL" {
+		t.Fatalf("expected the spot behind the one too big, got %+v", message.Spots)
+	}
+	if spotter.queue.len() != 0 || spotter.Overflowed() != 1 {
+		t.Errorf("expected an empty queue and 1 dropped, got %d and %d", spotter.queue.len(), spotter.Overflowed())
+	}
 }
@@ -0,0 +1,180 @@
+// Package js8call feeds spots from JS8Call's JSON API into a Spotter
+//
+// JS8Call's API is enabled under Settings, Reporting, API; this package connects to its TCP server, where every
+// message is a JSON object on a line of its own.
+package js8call
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/kahara/go-pskreporter-spot"
+	"github.com/rs/zerolog/log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAddress = "127.0.0.1:2442"
+	Mode           = "JS8"
+	ReconnectDelay = 5 * time.Second
+	MaxLineLength  = 1024 * 1024
+)
+
+const (
+	MessageType_RxActivity      = "RX.ACTIVITY"
+	MessageType_RxSpot          = "RX.SPOT"
+	MessageType_StationStatus   = "STATION.STATUS"
+	MessageType_StationCallsign = "STATION.CALLSIGN"
+	MessageType_StationGrid     = "STATION.GRID"
+	MessageType_GetCallsign     = "STATION.GET_CALLSIGN"
+	MessageType_GetGrid         = "STATION.GET_GRID"
+)
+
+// Message is one line of the API, in either direction
+type Message struct {
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Params Params `json:"params"`
+}
+
+// Params holds the parameters used here; JS8Call sends others, too
+type Params struct {
+	Call   string `json:"CALL,omitempty"`
+	Grid   string `json:"GRID,omitempty"`
+	Dial   uint64 `json:"DIAL,omitempty"`   // Hz
+	Freq   uint64 `json:"FREQ,omitempty"`   // Hz, dial plus offset
+	Offset uint64 `json:"OFFSET,omitempty"` // Hz
+	SNR    int    `json:"SNR,omitempty"`
+	UTC    int64  `json:"UTC,omitempty"` // Milliseconds since the epoch
+}
+
+// Spotter is what spots get fed into; usually a *spot.Spotter
+type Spotter interface {
+	spot.Feeder
+	SetReceiver(receiver spot.Station) error
+}
+
+// Client keeps a connection to JS8Call's API, feeding RX.SPOT events into a Spotter, and keeping the Spotter's
+// receiver in line with the operator's callsign and grid
+type Client struct {
+	address        string
+	spotter        Spotter
+	mutex          sync.Mutex
+	station        spot.Station
+	reconnectDelay time.Duration
+	now            func() time.Time
+}
+
+func NewClient(address string, spotter Spotter) *Client {
+	return &Client{
+		address:        address,
+		spotter:        spotter,
+		reconnectDelay: ReconnectDelay,
+		now:            time.Now,
+	}
+}
+
+// Run connects to the API, reconnecting whenever the connection is lost, until ctx is done
+func (c *Client) Run(ctx context.Context) error {
+	return spot.Redial(ctx, "JS8Call API", c.address, c.reconnectDelay, c.serve)
+}
+
+func (c *Client) serve(conn net.Conn) error {
+	// The operator may have changed callsign or grid while disconnected
+	if err := c.request(conn, MessageType_GetCallsign, MessageType_GetGrid); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), MaxLineLength)
+	for scanner.Scan() {
+		var message Message
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			log.Warn().Err(err).Msg("Could not parse JS8Call message")
+			continue
+		}
+
+		// Station status doesn't say who the operator is, but it's a good hint to ask again
+		if message.Type == MessageType_StationStatus {
+			if err := c.request(conn, MessageType_GetCallsign, MessageType_GetGrid); err != nil {
+				return err
+			}
+		}
+
+		c.handle(&message)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return net.ErrClosed
+}
+
+func (c *Client) request(conn net.Conn, types ...string) error {
+	for _, t := range types {
+		line, err := json.Marshal(Message{Type: t})
+		if err != nil {
+			return err
+		}
+		if _, err = conn.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) handle(message *Message) {
+	switch message.Type {
+	case MessageType_RxSpot:
+		if s := c.spot(&message.Params); s != nil {
+			c.spotter.Feed(s)
+		}
+	case MessageType_StationCallsign:
+		c.setStation(func(station *spot.Station) { station.Callsign = strings.TrimSpace(message.Value) })
+	case MessageType_StationGrid:
+		c.setStation(func(station *spot.Station) { station.Locator = strings.TrimSpace(message.Value) })
+	}
+}
+
+func (c *Client) setStation(update func(station *spot.Station)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	station := c.station
+	update(&station)
+	if station == c.station {
+		return
+	}
+	c.station = station
+
+	// Until the callsign is known there's nothing to set
+	if station.Callsign == "" {
+		return
+	}
+	if err := c.spotter.SetReceiver(station); err != nil {
+		log.Warn().Err(err).Msg("Could not update receiver from JS8Call")
+		return
+	}
+	log.Info().Str("callsign", station.Callsign).Str("locator", station.Locator).Msg("Receiver updated from JS8Call")
+}
+
+func (c *Client) spot(params *Params) *spot.Spot {
+	if params.Call == "" {
+		return nil
+	}
+
+	frequency := params.Freq
+	if frequency == 0 {
+		frequency = params.Dial + params.Offset
+	}
+
+	flowStart := c.now()
+	if params.UTC != 0 {
+		flowStart = time.UnixMilli(params.UTC)
+	}
+
+	return spot.NewSpot(strings.TrimSpace(params.Call), strings.TrimSpace(params.Grid), frequency, spot.ClampedSNR(params.SNR), 0, Mode, spot.InformationSource_AutomaticallyExtracted, uint32(flowStart.Unix()))
+}
@@ -0,0 +1,107 @@
+package js8call
+
+import (
+	"bufio"
+	"context"
+	"github.com/kahara/go-pskreporter-spot"
+	"github.com/kahara/go-pskreporter-spot/spottest"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Records receivers as well as spots
+type spotter struct {
+	spottest.Feeder
+	mutex     sync.Mutex
+	receivers []spot.Station
+}
+
+func (s *spotter) SetReceiver(receiver spot.Station) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.receivers = append(s.receivers, receiver)
+	return nil
+}
+
+func TestClient(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	var (
+		s           spotter
+		client      = NewClient(listener.Addr().String(), &s)
+		ctx, cancel = context.WithCancel(context.Background())
+		stopped     = make(chan bool)
+	)
+	client.reconnectDelay = 10 * time.Millisecond
+	go func() {
+		_ = client.Run(ctx)
+		close(stopped)
+	}()
+
+	// JS8Call goes away after the first spot, and the client comes back
+	for _, lines := range [][]string{
+		{
+			`{"type":"STATION.CALLSIGN","value":"N0CALL","params":{"_ID":1}}`,
+			`{"type":"STATION.GRID","value":"JJ00OG","params":{"_ID":2}}`,
+			`{"type":"RX.SPOT","value":"","params":{"CALL":"K1ABC","DIAL":7078000,"FREQ":7079950,"GRID":" FN42","OFFSET":1950,"SNR":-12,"UTC":1669896000000,"_ID":-1}}`,
+		},
+		{
+			`{"type":"STATION.GRID","value":"JJ00OH","params":{"_ID":3}}`,
+			`not json`,
+			`{"type":"RX.ACTIVITY","value":"K1ABC: HELLO","params":{"FREQ":7079950,"SNR":-12}}`,
+			`{"type":"RX.SPOT","value":"","params":{"CALL":"W9XYZ","DIAL":14078000,"OFFSET":1000,"SNR":3,"UTC":1669896015000}}`,
+		},
+	} {
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The client asks who the operator is right away
+		reader := bufio.NewReader(conn)
+		for _, want := range []string{`{"type":"STATION.GET_CALLSIGN","value":"","params":{}}`, `{"type":"STATION.GET_GRID","value":"","params":{}}`} {
+			if got, err := reader.ReadString('\n'); err != nil || got != want+"\n" {
+				t.Errorf("expected %s, got %q, %v", want, got, err)
+			}
+		}
+
+		for _, line := range lines {
+			_, _ = conn.Write([]byte(line + "\n"))
+		}
+		_ = conn.Close()
+	}
+
+	s.WaitForSpots(2, 5*time.Second)
+	cancel()
+	<-stopped
+
+	wantSpots := []*spot.Spot{
+		spot.NewSpot("K1ABC", "FN42", 7079950, -12, 0, "JS8", 1, 1669896000),
+		spot.NewSpot("W9XYZ", "", 14079000, 3, 0, "JS8", 1, 1669896015),
+	}
+	spots := s.Spots()
+	if len(spots) != len(wantSpots) {
+		t.Fatalf("expected %d spots, got %d", len(wantSpots), len(spots))
+	}
+	for i := range wantSpots {
+		if *spots[i] != *wantSpots[i] {
+			t.Errorf("spot %d: expected %+v, got %+v", i, *wantSpots[i], *spots[i])
+		}
+	}
+
+	wantReceivers := []spot.Station{{Callsign: "N0CALL"}, {Callsign: "N0CALL", Locator: "JJ00OG"}, {Callsign: "N0CALL", Locator: "JJ00OH"}}
+	if len(s.receivers) != len(wantReceivers) {
+		t.Fatalf("expected receivers %+v, got %+v", wantReceivers, s.receivers)
+	}
+	for i := range wantReceivers {
+		if s.receivers[i] != wantReceivers[i] {
+			t.Errorf("receiver %d: expected %+v, got %+v", i, wantReceivers[i], s.receivers[i])
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Package maidenhead validates Maidenhead locators, converts them to and from latitude and longitude,
+// and tells the distance and bearing between them
+package maidenhead
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	EarthRadius = 6371.0088 // Mean radius in km
+	MaxLength   = 10        // Characters in the most precise locator, two for each division
+)
+
+var (
+	ErrLocator  = errors.New("invalid Maidenhead locator")
+	ErrPosition = errors.New("position out of range")
+)
+
+// Each pair of characters divides the previous square: into 18 by 18 fields, then 10 by 10 squares,
+// 24 by 24 subsquares, 10 by 10 extended squares and 24 by 24 extended subsquares
+var divisions = []struct {
+	count int
+	first byte // In the usual case, such as "JN58td25"
+}{
+	{18, 'A'},
+	{10, '0'},
+	{24, 'a'},
+	{10, '0'},
+	{24, 'a'},
+}
+
+// Valid tells whether locator is a 2, 4, 6, 8 or 10 character locator, in any case
+func Valid(locator string) bool {
+	_, err := Normalize(locator)
+	return err == nil
+}
+
+// Normalize checks locator and returns it in the usual case, with the field in upper case and subsquares in lower,
+// like "JN58td25"
+func Normalize(locator string) (string, error) {
+	if len(locator) == 0 || len(locator)%2 != 0 || len(locator) > MaxLength {
+		return "", fmt.Errorf("%w: %q has %d characters", ErrLocator, locator, len(locator))
+	}
+
+	normalized := make([]byte, len(locator))
+	for i := 0; i < len(locator); i++ {
+		division := divisions[i/2]
+
+		c := locator[i]
+		if division.first != '0' {
+			// Letters may come in either case
+			c = division.first + (c | 0x20) - 'a'
+		}
+		if c < division.first || c >= division.first+byte(division.count) {
+			return "", fmt.Errorf("%w: %q", ErrLocator, locator)
+		}
+		normalized[i] = c
+	}
+
+	return string(normalized), nil
+}
+
+// FromLatLon returns the locator of length characters (2, 4, 6, 8 or 10) for a position in degrees
+func FromLatLon(latitude float64, longitude float64, length int) (string, error) {
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 || math.IsNaN(latitude) || math.IsNaN(longitude) {
+		return "", fmt.Errorf("%w: %f, %f", ErrPosition, latitude, longitude)
+	}
+	if length < 2 || length%2 != 0 || length > MaxLength {
+		return "", fmt.Errorf("%w: no such thing as %d characters", ErrLocator, length)
+	}
+
+	var (
+		locator = make([]byte, 0, length)
+		lon     = longitude + 180
+		lat     = latitude + 90
+		width   = 360.0
+		height  = 180.0
+	)
+
+	for _, division := range divisions[:length/2] {
+		width /= float64(division.count)
+		height /= float64(division.count)
+
+		x, y := int(lon/width), int(lat/height)
+		// The north pole and the antimeridian fall just outside the last square otherwise
+		x, y = clamp(x, division.count-1), clamp(y, division.count-1)
+		lon -= float64(x) * width
+		lat -= float64(y) * height
+
+		locator = append(locator, division.first+byte(x), division.first+byte(y))
+	}
+
+	return string(locator), nil
+}
+
+// ToLatLon returns the position in degrees of the center of the square locator stands for
+func ToLatLon(locator string) (latitude float64, longitude float64, err error) {
+	locator, err = Normalize(locator)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		lon    = -180.0
+		lat    = -90.0
+		width  = 360.0
+		height = 180.0
+	)
+	for i := 0; i < len(locator); i += 2 {
+		division := divisions[i/2]
+		width /= float64(division.count)
+		height /= float64(division.count)
+
+		lon += float64(locator[i]-division.first) * width
+		lat += float64(locator[i+1]-division.first) * height
+	}
+
+	return lat + height/2, lon + width/2, nil
+}
+
+func clamp(value int, max int) int {
+	if value < 0 {
+		return 0
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+// Distance returns the great-circle distance in km between the centers of two locators
+func Distance(from string, to string) (float64, error) {
+	lat1, lon1, lat2, lon2, err := radians(from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	// Haversine, which holds up for short distances too
+	a := math.Pow(math.Sin((lat2-lat1)/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin((lon2-lon1)/2), 2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(a))), nil
+}
+
+// Bearing returns the initial great-circle bearing in degrees from north, 0 to 360, from one locator's center to
+// another's
+func Bearing(from string, to string) (float64, error) {
+	lat1, lon1, lat2, lon2, err := radians(from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	y := math.Sin(lon2-lon1) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(lon2-lon1)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360), nil
+}
+
+func radians(from string, to string) (float64, float64, float64, float64, error) {
+	lat1, lon1, err := ToLatLon(from)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	lat2, lon2, err := ToLatLon(to)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+
+	const toRadians = math.Pi / 180
+	return lat1 * toRadians, lon1 * toRadians, lat2 * toRadians, lon2 * toRadians, nil
+}
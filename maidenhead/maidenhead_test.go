@@ -0,0 +1,123 @@
+package maidenhead
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	for _, tt := range []struct {
+		locator string
+		want    string
+		err     error
+	}{
+		{"JJ00OG", "JJ00og", nil},
+		{"jn58TD25", "JN58td25", nil},
+		{"kp20le47sx", "KP20le47sx", nil},
+		{"RR", "RR", nil},
+		{"FN42", "FN42", nil},
+		{"JJ00OGG", "", ErrLocator},
+		{"JJ00OG0", "", ErrLocator},
+		{"SS00", "", ErrLocator}, // Fields only go up to R
+		{"JJ00YY", "", ErrLocator},
+		{"JJAA", "", ErrLocator},
+		{"JJ00og00aa00", "", ErrLocator},
+		{"JJ 0", "", ErrLocator},
+		{"", "", ErrLocator},
+	} {
+		got, err := Normalize(tt.locator)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("%q: expected %q and %v, got %q and %v", tt.locator, tt.want, tt.err, got, err)
+		}
+		if Valid(tt.locator) != (tt.err == nil) {
+			t.Errorf("%q: expected valid to be %v", tt.locator, tt.err == nil)
+		}
+	}
+}
+
+func TestFromLatLon(t *testing.T) {
+	for _, tt := range []struct {
+		latitude  float64
+		longitude float64
+		length    int
+		want      string
+		err       error
+	}{
+		{48.14666, 11.60833, 8, "JN58td25", nil}, // Munich
+		{41.714775, -72.727260, 6, "FN31pr", nil},
+		{60.17, 24.94, 6, "KP20le", nil},
+		{-33.86, 151.21, 6, "QF56od", nil},
+		{-33.86, 151.21, 4, "QF56", nil},
+		{90, 180, 8, "RR99xx99", nil},
+		{-90, -180, 10, "AA00aa00aa", nil},
+		{91, 0, 6, "", ErrPosition},
+		{0, -181, 6, "", ErrPosition},
+		{0, 0, 7, "", ErrLocator},
+		{0, 0, 12, "", ErrLocator},
+	} {
+		got, err := FromLatLon(tt.latitude, tt.longitude, tt.length)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("%f, %f: expected %q and %v, got %q and %v", tt.latitude, tt.longitude, tt.want, tt.err, got, err)
+		}
+	}
+}
+
+func TestToLatLon(t *testing.T) {
+	for _, tt := range []struct {
+		locator   string
+		latitude  float64
+		longitude float64
+	}{
+		{"JJ", 5, 10},
+		{"jj00", 0.5, 1},
+		{"JN58td25", 48.1479, 11.6042},
+	} {
+		latitude, longitude, err := ToLatLon(tt.locator)
+		if err != nil || math.Abs(latitude-tt.latitude) > 0.0001 || math.Abs(longitude-tt.longitude) > 0.0001 {
+			t.Errorf("%q: expected %f, %f, got %f, %f and %v", tt.locator, tt.latitude, tt.longitude, latitude, longitude, err)
+		}
+
+		// The center of a square is in that square
+		if locator, _ := FromLatLon(latitude, longitude, len(tt.locator)); !equalFold(locator, tt.locator) {
+			t.Errorf("%q: round trip gave %q", tt.locator, locator)
+		}
+	}
+
+	if _, _, err := ToLatLon("JJ00OGG"); !errors.Is(err, ErrLocator) {
+		t.Errorf("expected %v, got %v", ErrLocator, err)
+	}
+}
+
+func equalFold(a string, b string) bool {
+	na, _ := Normalize(a)
+	nb, _ := Normalize(b)
+	return na == nb
+}
+
+func TestDistanceBearing(t *testing.T) {
+	for _, tt := range []struct {
+		from     string
+		to       string
+		distance float64
+		bearing  float64
+	}{
+		{"IO91wm", "FN20xr", 5571, 288.4}, // London to New York
+		{"FN20xr", "IO91wm", 5571, 51.2},
+		{"KP20le", "QF56od", 15198, 77.4},
+		{"KP20le", "kp20LE", 0, 0},
+	} {
+		distance, err := Distance(tt.from, tt.to)
+		if err != nil || math.Abs(distance-tt.distance) > 1 {
+			t.Errorf("%s to %s: expected %.0f km, got %f and %v", tt.from, tt.to, tt.distance, distance, err)
+		}
+		bearing, err := Bearing(tt.from, tt.to)
+		if err != nil || math.Abs(bearing-tt.bearing) > 0.1 {
+			t.Errorf("%s to %s: expected %.1f degrees, got %f and %v", tt.from, tt.to, tt.bearing, bearing, err)
+		}
+	}
+
+	if _, err := Distance("KP20le", "KP2"); !errors.Is(err, ErrLocator) {
+		t.Errorf("expected %v, got %v", ErrLocator, err)
+	}
+}
@@ -0,0 +1,217 @@
+package spot
+
+import (
+	"context"
+	"errors"
+	"github.com/kahara/go-pskreporter-spot/bandplan"
+	"sync"
+)
+
+// What Feed does when the queue is full, such as while the network is down
+const (
+	Overflow_Block      = iota // Wait for room; TryFeed gives up instead
+	Overflow_DropNewest        // Drop the spot being fed
+	Overflow_DropOldest        // Drop the spot that has waited longest, to make room
+	Overflow_Coalesce          // Keep the better of the spot and a queued one of the same sender, band and mode, or failing that, drop the spot
+)
+
+var ErrQueueFull = errors.New("queue is full")
+
+// Spots waiting to be sent, in order of flowStartSeconds and then in the order they were fed; a ring, so that taking
+// spots from the front and putting them back there is as cheap as adding them at the back
+type queue struct {
+	mutex  sync.Mutex
+	ring   []*Spot // Grown as needed, holding count spots from head on, wrapping around
+	head   int
+	count  int
+	size   int
+	policy int
+	plan   bandplan.Plan // For telling which spots are duplicates
+	space  chan bool     // Closed, and replaced, when a full queue has room again
+}
+
+const minQueueRing = 16
+
+func newQueue(size int, policy int, plan bandplan.Plan) *queue {
+	return &queue{
+		size:   size,
+		policy: policy,
+		plan:   plan,
+		space:  make(chan bool),
+	}
+}
+
+// Add a spot in order, as the overflow policy says when the queue is full, waiting for room only if wait is set;
+// returns the spot that didn't make it or was dropped to make room, if any
+func (q *queue) push(ctx context.Context, spot *Spot, wait bool) (*Spot, error) {
+	for {
+		q.mutex.Lock()
+		if q.count < q.size {
+			q.insert(spot)
+			q.mutex.Unlock()
+			return nil, nil
+		}
+
+		switch q.policy {
+		case Overflow_DropNewest:
+			q.mutex.Unlock()
+			return spot, ErrQueueFull
+		case Overflow_DropOldest:
+			q.insert(spot)
+			dropped := q.remove(0)
+			q.mutex.Unlock()
+			return dropped, nil
+		case Overflow_Coalesce:
+			dropped, err := q.coalesce(spot)
+			q.mutex.Unlock()
+			return dropped, err
+		}
+
+		space := q.space
+		q.mutex.Unlock()
+		if !wait {
+			return spot, ErrQueueFull
+		}
+		select {
+		case <-space:
+		case <-ctx.Done():
+			return spot, ctx.Err()
+		}
+	}
+}
+
+// Keep the better of spot and a queued duplicate of it; the caller holds the mutex
+func (q *queue) coalesce(spot *Spot) (*Spot, error) {
+	key := newDedupKey(spot, q.plan)
+	for i := 0; i < q.count; i++ {
+		queued := q.at(i)
+		if newDedupKey(queued, q.plan) != key {
+			continue
+		}
+		if spot.snr > queued.snr {
+			q.remove(i)
+			q.insert(spot)
+			return queued, nil
+		}
+		return spot, nil
+	}
+	return spot, ErrQueueFull
+}
+
+// Put spots back at the front, in the order given, even if there's no room for them; they were there first
+func (q *queue) pushFront(spots ...*Spot) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i := len(spots) - 1; i >= 0; i-- {
+		q.grow()
+		q.head = (q.head - 1 + len(q.ring)) % len(q.ring)
+		q.ring[q.head] = spots[i]
+		q.count++
+	}
+}
+
+// The oldest spot without taking it, or nil if there's none; it may be gone by the time it's popped, see popIf
+func (q *queue) peek() *Spot {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.count == 0 {
+		return nil
+	}
+	return q.at(0)
+}
+
+// Take the oldest spot, or nil if there's none
+func (q *queue) pop() *Spot {
+	return q.popIf(func(*Spot) bool { return true })
+}
+
+// Take the oldest spot if take, looking at it in place, says so; nil if there's none or take says no. take runs with
+// the queue locked, so the spot it looks at is the one that gets taken
+func (q *queue) popIf(take func(spot *Spot) bool) *Spot {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.count == 0 || !take(q.at(0)) {
+		return nil
+	}
+	return q.remove(0)
+}
+
+func (q *queue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.count
+}
+
+// How many more spots fit
+func (q *queue) free() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.count > q.size {
+		return 0
+	}
+	return q.size - q.count
+}
+
+// The rest expect the caller to hold the mutex
+
+func (q *queue) at(i int) *Spot {
+	return q.ring[(q.head+i)%len(q.ring)]
+}
+
+func (q *queue) set(i int, spot *Spot) {
+	q.ring[(q.head+i)%len(q.ring)] = spot
+}
+
+// Make room for at least one more spot
+func (q *queue) grow() {
+	if q.count < len(q.ring) {
+		return
+	}
+
+	ring := make([]*Spot, 2*len(q.ring)+minQueueRing)
+	for i := 0; i < q.count; i++ {
+		ring[i] = q.at(i)
+	}
+	q.ring = ring
+	q.head = 0
+}
+
+// Insert a spot after every spot that didn't start later; spots are mostly fed in order, so this is mostly appending
+func (q *queue) insert(spot *Spot) {
+	q.grow()
+
+	i := q.count
+	for i > 0 && q.at(i-1).flowStartSeconds > spot.flowStartSeconds {
+		i--
+	}
+	q.count++
+	for j := q.count - 1; j > i; j-- {
+		q.set(j, q.at(j-1))
+	}
+	q.set(i, spot)
+}
+
+func (q *queue) remove(i int) *Spot {
+	spot := q.at(i)
+	if i == 0 {
+		q.set(0, nil)
+		q.head = (q.head + 1) % len(q.ring)
+	} else {
+		for j := i; j < q.count-1; j++ {
+			q.set(j, q.at(j+1))
+		}
+		q.set(q.count-1, nil)
+	}
+	q.count--
+
+	if q.count == q.size-1 {
+		close(q.space)
+		q.space = make(chan bool)
+	}
+	return spot
+}
@@ -0,0 +1,153 @@
+package spot
+
+import (
+	"context"
+	"errors"
+	"github.com/kahara/go-pskreporter-spot/bandplan"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	var (
+		a   = NewSpot("N1CALL", "", 14074000, -10, 0, "FT8", 1, 0)
+		b   = NewSpot("N2CALL", "", 14074000, -10, 0, "FT8", 1, 0)
+		c   = NewSpot("N3CALL", "", 14074000, -10, 0, "FT8", 1, 0)
+		dup = NewSpot("N1CALL", "", 14075000, 0, 0, "FT8", 1, 0) // Better than a, on the same band
+	)
+
+	for _, tt := range []struct {
+		name    string
+		policy  int
+		queued  []*Spot
+		spot    *Spot
+		dropped *Spot
+		err     error
+		want    []*Spot
+	}{
+		{"block", Overflow_Block, []*Spot{a, b}, c, c, ErrQueueFull, []*Spot{a, b}},
+		{"drop newest", Overflow_DropNewest, []*Spot{a, b}, c, c, ErrQueueFull, []*Spot{a, b}},
+		{"drop oldest", Overflow_DropOldest, []*Spot{a, b}, c, a, nil, []*Spot{b, c}},
+		{"coalesce", Overflow_Coalesce, []*Spot{a, b}, dup, a, nil, []*Spot{b, dup}},
+		{"coalesce worse", Overflow_Coalesce, []*Spot{dup, b}, a, a, nil, []*Spot{dup, b}},
+		{"coalesce nothing", Overflow_Coalesce, []*Spot{a, b}, c, c, ErrQueueFull, []*Spot{a, b}},
+	} {
+		q := newQueue(2, tt.policy, bandplan.Worldwide)
+		for _, spot := range tt.queued {
+			if dropped, err := q.push(context.Background(), spot, false); dropped != nil || err != nil {
+				t.Fatalf("%s: expected room, got %v and %v", tt.name, dropped, err)
+			}
+		}
+
+		dropped, err := q.push(context.Background(), tt.spot, false)
+		if dropped != tt.dropped || !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v and %v, got %v and %v", tt.name, tt.dropped, tt.err, dropped, err)
+		}
+		if q.len() != len(tt.want) || q.free() != 0 {
+			t.Errorf("%s: expected %d spots and no room, got %d and %d", tt.name, len(tt.want), q.len(), q.free())
+		}
+		for i, want := range tt.want {
+			if got := q.pop(); got != want {
+				t.Errorf("%s: spot %d: expected %+v, got %+v", tt.name, i, want, got)
+			}
+		}
+		if got := q.pop(); got != nil {
+			t.Errorf("%s: expected nothing left, got %+v", tt.name, got)
+		}
+	}
+}
+
+func TestQueueBlock(t *testing.T) {
+	var (
+		a = NewSpot("N1CALL", "", 14074000, -10, 0, "FT8", 1, 0)
+		b = NewSpot("N2CALL", "", 14074000, -10, 0, "FT8", 1, 0)
+		c = NewSpot("N3CALL", "", 14074000, -10, 0, "FT8", 1, 0)
+		q = newQueue(1, Overflow_Block, bandplan.Worldwide)
+	)
+	_, _ = q.push(context.Background(), a, true)
+
+	// Gives up when ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if dropped, err := q.push(ctx, b, true); dropped != b || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v and %v", context.DeadlineExceeded, dropped, err)
+	}
+
+	// Gets in once there's room
+	done := make(chan error)
+	go func() {
+		_, err := q.push(context.Background(), b, true)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("expected push to wait while the queue is full, got %v", err)
+	default:
+	}
+	if got := q.pop(); got != a {
+		t.Errorf("expected %+v, got %+v", a, got)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected push to get in")
+	}
+
+	// Spots put back go first, even if there's no room for them
+	q.pushFront(c, a)
+	if q.len() != 3 || q.free() != 0 {
+		t.Errorf("expected 3 spots and no room, got %d and %d", q.len(), q.free())
+	}
+	for _, want := range []*Spot{c, a, b} {
+		if got := q.pop(); got != want {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+	}
+}
+
+func TestQueueOrder(t *testing.T) {
+	q := newQueue(100, Overflow_Block, bandplan.Worldwide)
+
+	// Enough to wrap around and grow the ring a few times, taking spots as it goes
+	var want []uint32
+	for i := 0; i < 40; i++ {
+		if i%3 == 2 {
+			if got := q.pop(); got.flowStartSeconds != want[0] {
+				t.Errorf("expected %d, got %d", want[0], got.flowStartSeconds)
+			}
+			want = want[1:]
+		}
+		flowStartSeconds := uint32(1000 + i)
+		if i%10 == 9 {
+			flowStartSeconds -= 5 // Late, so it goes ahead of some already queued
+		}
+		_, _ = q.push(context.Background(), NewSpot("N1CALL", "", 14074000, 0, 0, "FT8", 1, flowStartSeconds), false)
+		want = append(want, flowStartSeconds)
+		sort.SliceStable(want, func(i, j int) bool { return want[i] < want[j] })
+	}
+
+	// Taken but not sent, so put back where they were
+	first, second := q.pop(), q.pop()
+	q.pushFront(first, second)
+
+	// Peeking, or declining to take, leaves the spot where it is
+	if got := q.peek(); got == nil || got.flowStartSeconds != want[0] {
+		t.Errorf("expected to peek %d, got %+v", want[0], got)
+	}
+	if got := q.popIf(func(*Spot) bool { return false }); got != nil || q.len() != len(want) {
+		t.Errorf("expected nothing taken, got %+v and %d left", got, q.len())
+	}
+
+	for i, flowStartSeconds := range want {
+		if got := q.pop(); got.flowStartSeconds != flowStartSeconds {
+			t.Errorf("spot %d: expected %d, got %d", i, flowStartSeconds, got.flowStartSeconds)
+		}
+	}
+	if q.len() != 0 || q.peek() != nil {
+		t.Errorf("expected nothing left, got %d", q.len())
+	}
+}
@@ -0,0 +1,134 @@
+package rbn
+
+import (
+	"bufio"
+	"context"
+	"github.com/kahara/go-pskreporter-spot"
+	"github.com/rs/zerolog/log"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultAddress = "telnet.reversebeacon.net:7000"
+	ReconnectDelay = 10 * time.Second
+	MaxLineLength  = 4096
+)
+
+// Telnet commands that may precede option negotiation
+const (
+	telnetIAC = 255
+	telnetSB  = 250
+	telnetSE  = 240
+)
+
+// Client logs in to a skimmer's or an aggregator's telnet server and feeds the skims into a spot.Feeder
+type Client struct {
+	address        string
+	login          string
+	feeder         spot.Feeder
+	skimmers       map[string]bool
+	reconnectDelay time.Duration
+	now            func() time.Time
+}
+
+// NewClient returns a Client that logs in as login, accepting skims only from the given skimmer callsigns, or from
+// any skimmer if none are given
+//
+// PSK Reporter attributes the skims to the Spotter's receiver, so usually only one's own skimmer should be accepted.
+func NewClient(address string, login string, feeder spot.Feeder, skimmers ...string) *Client {
+	client := &Client{
+		address:        address,
+		login:          login,
+		feeder:         feeder,
+		reconnectDelay: ReconnectDelay,
+		now:            time.Now,
+	}
+
+	if len(skimmers) > 0 {
+		client.skimmers = make(map[string]bool)
+		for _, skimmer := range skimmers {
+			client.skimmers[strings.ToUpper(skimmer)] = true
+		}
+	}
+
+	return client
+}
+
+// Run connects to the server, reconnecting whenever the connection is lost, until ctx is done
+func (c *Client) Run(ctx context.Context) error {
+	return spot.Redial(ctx, "skimmer", c.address, c.reconnectDelay, c.serve)
+}
+
+func (c *Client) serve(conn net.Conn) error {
+	var (
+		reader   = bufio.NewReader(conn)
+		line     []byte
+		loggedIn = false
+	)
+
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case b == telnetIAC:
+			// Options aren't negotiated; skip the command, and a subnegotiation if one follows
+			command, err := reader.ReadByte()
+			if err != nil {
+				return err
+			}
+			if command == telnetSB {
+				for b != telnetSE {
+					if b, err = reader.ReadByte(); err != nil {
+						return err
+					}
+				}
+			} else if command != telnetIAC {
+				if _, err = reader.ReadByte(); err != nil {
+					return err
+				}
+			}
+		case b == '\n':
+			c.handle(strings.TrimSpace(string(line)))
+			line = line[:0]
+		case len(line) < MaxLineLength:
+			line = append(line, b)
+		}
+
+		// The login prompt isn't followed by a newline
+		if !loggedIn && isPrompt(line) {
+			if _, err = conn.Write([]byte(c.login + "\r\n")); err != nil {
+				return err
+			}
+			loggedIn = true
+			line = line[:0]
+		}
+	}
+}
+
+// "Please enter your call: ", "login: "
+func isPrompt(line []byte) bool {
+	prompt := strings.ToLower(strings.TrimSpace(string(line)))
+	return strings.HasSuffix(prompt, "call:") || strings.HasSuffix(prompt, "login:")
+}
+
+func (c *Client) handle(line string) {
+	if !strings.HasPrefix(strings.ToUpper(line), "DX DE ") {
+		return
+	}
+
+	skim, err := ParseSkim(line)
+	if err != nil {
+		log.Debug().Err(err).Msg("Could not parse skim")
+		return
+	}
+	if c.skimmers != nil && !c.skimmers[skim.Skimmer] {
+		return
+	}
+
+	c.feeder.Feed(skim.Spot(c.now()))
+}
@@ -0,0 +1,67 @@
+package rbn
+
+import (
+	"bufio"
+	"context"
+	"github.com/kahara/go-pskreporter-spot/spottest"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	var (
+		f           spottest.Feeder
+		client      = NewClient(listener.Addr().String(), "N0CALL", &f, "n0call")
+		ctx, cancel = context.WithCancel(context.Background())
+		stopped     = make(chan bool)
+	)
+	client.reconnectDelay = 10 * time.Millisecond
+	go func() {
+		_ = client.Run(ctx)
+		close(stopped)
+	}()
+
+	// A stand-in for CW Skimmer Server; it goes away after the first spot, and the client comes back
+	for _, lines := range [][]string{
+		{
+			"DX de N0CALL-#:  14020.0  K1ABC        CW    24 dB  22 WPM  CQ      1234Z\r\n",
+			"DX de KM3T-#:    14021.0  W9XYZ        CW    10 dB  25 WPM  CQ      1234Z\r\n",
+		},
+		{
+			"N0CALL de SKIMMER 2022-12-01 12:35Z CwSkimServer >\r\n",
+			"DX de N0CALL-#:   7018.5  PY2XYZ       CW    -3 dB  28 WPM  CQ      1235Z\r\n",
+		},
+	} {
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Option negotiation and a prompt without a newline
+		_, _ = conn.Write([]byte{telnetIAC, 251, 1})
+		_, _ = conn.Write([]byte("\r\nPlease enter your call: "))
+		if got, err := bufio.NewReader(conn).ReadString('\n'); err != nil || got != "N0CALL\r\n" {
+			t.Errorf("expected login, got %q, %v", got, err)
+		}
+
+		for _, line := range lines {
+			_, _ = conn.Write([]byte(line))
+		}
+		_ = conn.Close()
+	}
+
+	f.WaitForSpots(2, 5*time.Second)
+	cancel()
+	<-stopped
+
+	if spots := f.Spots(); len(spots) != 2 || spots[0].Sender().Callsign != "K1ABC" || spots[1].Sender().Callsign != "PY2XYZ" || spots[1].Frequency() != 7018500 {
+		t.Errorf("unexpected spots %+v", spots)
+	}
+}
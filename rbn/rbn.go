@@ -0,0 +1,82 @@
+// Package rbn turns the "DX de" lines CW Skimmer and Reverse Beacon Network telnet servers publish into spots
+package rbn
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kahara/go-pskreporter-spot"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What the spotted station was doing
+const (
+	Type_CQ     = "CQ"
+	Type_Beacon = "BEACON"
+	Type_NCDXF  = "NCDXF B" // One of the NCDXF/IARU beacons
+	Type_DX     = "DX"
+)
+
+var ErrNotSkim = errors.New("not a skimmer spot")
+
+// DX de KM3T-#:    14020.0  K1ABC        CW    24 dB  22 WPM  CQ      1234Z, matched in upper case
+var skimPattern = regexp.MustCompile(`^DX DE ([A-Z0-9/]+)(?:-[#0-9]+)*:\s+(\d+(?:\.\d+)?)\s+([A-Z0-9/]+)\s+([A-Z0-9]+)\s+(-?\d+)\s+DB(?:\s+(\d+)\s+(WPM|BPS))?\s+(CQ|BEACON|NCDXF B|DX)\s+(\d{2})(\d{2})Z`)
+
+// Skim is one parsed spot line
+type Skim struct {
+	Skimmer   string // Without the "-#" suffix
+	Frequency uint64 // Hz
+	Callsign  string
+	Mode      string
+	SNR       int // dB
+	Speed     int // WPM for CW, BPS for RTTY, zero if not given
+	Type      string
+	Hour      int // UTC
+	Minute    int
+}
+
+// ParseSkim parses a "DX de" line from a skimmer
+func ParseSkim(line string) (*Skim, error) {
+	m := skimPattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(line)))
+	if m == nil {
+		return nil, fmt.Errorf("%w: %q", ErrNotSkim, line)
+	}
+
+	kHz, err := strconv.ParseFloat(m[2], 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: frequency %q", ErrNotSkim, m[2])
+	}
+	snr, _ := strconv.Atoi(m[5])
+	speed, _ := strconv.Atoi(m[6])
+	hour, _ := strconv.Atoi(m[9])
+	minute, _ := strconv.Atoi(m[10])
+	if hour > 23 || minute > 59 {
+		return nil, fmt.Errorf("%w: time %s%sZ", ErrNotSkim, m[9], m[10])
+	}
+
+	return &Skim{
+		Skimmer:   m[1],
+		Frequency: uint64(math.Round(kHz * 1000)),
+		Callsign:  m[3],
+		Mode:      m[4],
+		SNR:       snr,
+		Speed:     speed,
+		Type:      m[8],
+		Hour:      hour,
+		Minute:    minute,
+	}, nil
+}
+
+// Spot turns the skim into a spot, putting its time of day on the most recent day that doesn't make it lie in the future
+func (s *Skim) Spot(now time.Time) *spot.Spot {
+	now = now.UTC()
+	flowStart := time.Date(now.Year(), now.Month(), now.Day(), s.Hour, s.Minute, 0, 0, time.UTC)
+	if flowStart.After(now.Add(time.Hour)) {
+		flowStart = flowStart.AddDate(0, 0, -1)
+	}
+
+	return spot.NewSpot(s.Callsign, "", s.Frequency, spot.ClampedSNR(s.SNR), 0, s.Mode, spot.InformationSource_AutomaticallyExtracted, uint32(flowStart.Unix()))
+}
@@ -0,0 +1,52 @@
+package rbn
+
+import (
+	"errors"
+	"github.com/kahara/go-pskreporter-spot"
+	"testing"
+	"time"
+)
+
+func TestParseSkim(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		want *Skim
+	}{
+		{"DX de KM3T-#:    14020.0  K1ABC        CW    24 dB  22 WPM  CQ      1234Z", &Skim{"KM3T", 14020000, "K1ABC", "CW", 24, 22, Type_CQ, 12, 34}},
+		{"DX de W3LPL-2-#:  7018.5  PY2XYZ       CW    -3 dB  28 WPM  CQ      0013Z\r", &Skim{"W3LPL", 7018500, "PY2XYZ", "CW", -3, 28, Type_CQ, 0, 13}},
+		{"DX de DK9IP-#:   14100.0  4U1UN        CW    12 dB  22 WPM  NCDXF B 2359Z", &Skim{"DK9IP", 14100000, "4U1UN", "CW", 12, 22, Type_NCDXF, 23, 59}},
+		{"DX de OH6BG-#:   28222.9  OH2B/B       CW     9 dB  18 WPM  BEACON  0801Z", &Skim{"OH6BG", 28222900, "OH2B/B", "CW", 9, 18, Type_Beacon, 8, 1}},
+		{"DX de EA5WU-#:   14080.0  K1ABC        RTTY  15 dB  45 BPS  CQ      0005Z", &Skim{"EA5WU", 14080000, "K1ABC", "RTTY", 15, 45, Type_CQ, 0, 5}},
+		{"DX de EA5WU-#:    3573.0  K1ABC        FT8   -9 dB          CQ      0005Z", &Skim{"EA5WU", 3573000, "K1ABC", "FT8", -9, 0, Type_CQ, 0, 5}},
+		{"DX de OH2ABC:    14025.0  K1ABC        599 tnx QSO                  1234Z", nil},
+		{"DX de KM3T-#:    14020.0  K1ABC        CW    24 dB  22 WPM  CQ      2534Z", nil},
+		{"Please enter your call:", nil},
+	} {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := ParseSkim(tt.line)
+			if tt.want == nil {
+				if !errors.Is(err, ErrNotSkim) {
+					t.Errorf("expected %v, got %+v, %v", ErrNotSkim, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != *tt.want {
+				t.Errorf("expected %+v, got %+v", *tt.want, *got)
+			}
+		})
+	}
+}
+
+func TestSkimSpot(t *testing.T) {
+	skim := &Skim{"KM3T", 14020000, "K1ABC", "CW", 24, 22, Type_CQ, 23, 59}
+
+	// Shortly after midnight, a skim from just before it is from yesterday
+	now := time.Date(2022, 12, 2, 0, 1, 0, 0, time.UTC)
+	want := spot.NewSpot("K1ABC", "", 14020000, 24, 0, "CW", spot.InformationSource_AutomaticallyExtracted, uint32(time.Date(2022, 12, 1, 23, 59, 0, 0, time.UTC).Unix()))
+	if got := skim.Spot(now); *got != *want {
+		t.Errorf("expected %+v, got %+v", *want, *got)
+	}
+}
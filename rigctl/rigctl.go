@@ -0,0 +1,176 @@
+// Package rigctl follows a rig's dial frequency and mode through Hamlib's rigctld
+//
+// A Client is a spot.FrequencySource, so spots can be fed as audio offsets and get the rig's frequency added to them.
+package rigctl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kahara/go-pskreporter-spot"
+	"github.com/rs/zerolog/log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAddress = "127.0.0.1:4532"
+	PollInterval   = time.Second
+	MaxAge         = 5 * time.Second // How long a polled frequency is trusted without a fresh one
+	ReconnectDelay = 5 * time.Second
+	CommandTimeout = 5 * time.Second
+)
+
+var ErrCommand = errors.New("rigctld command failed")
+
+// Client polls rigctld over TCP, reconnecting when the rig or rigctld goes away
+type Client struct {
+	address        string
+	pollInterval   time.Duration
+	reconnectDelay time.Duration
+	mutex          sync.Mutex
+	dial           uint64
+	mode           string
+	passband       int
+	updated        time.Time
+	now            func() time.Time
+}
+
+func NewClient(address string) *Client {
+	return &Client{
+		address:        address,
+		pollInterval:   PollInterval,
+		reconnectDelay: ReconnectDelay,
+		now:            time.Now,
+	}
+}
+
+// DialFrequency returns the latest dial frequency in Hz, unless it hasn't been updated in MaxAge
+func (c *Client) DialFrequency() (uint64, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.updated.IsZero() || c.now().Sub(c.updated) > MaxAge {
+		return 0, false
+	}
+	return c.dial, true
+}
+
+// Mode returns the latest mode, such as "USB" or "PKTUSB", and passband in Hz
+func (c *Client) Mode() (string, int, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.updated.IsZero() || c.now().Sub(c.updated) > MaxAge {
+		return "", 0, false
+	}
+	return c.mode, c.passband, true
+}
+
+// Run polls until ctx is done
+func (c *Client) Run(ctx context.Context) error {
+	return spot.Redial(ctx, "rigctld", c.address, c.reconnectDelay, func(conn net.Conn) error {
+		return c.serve(ctx, conn)
+	})
+}
+
+func (c *Client) serve(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+
+	var (
+		reader    = bufio.NewReader(conn)
+		ticker    = time.NewTicker(c.pollInterval)
+		vfoInfo   = true // Until rigctld or the rig turns out not to support it
+		dial      uint64
+		mode      string
+		passband  int
+		err       error
+		responses map[string]string
+	)
+	defer ticker.Stop()
+
+	for {
+		_ = conn.SetDeadline(time.Now().Add(CommandTimeout))
+
+		if vfoInfo {
+			responses, err = command(conn, reader, `\get_vfo_info currVFO`)
+			if errors.Is(err, ErrCommand) {
+				log.Info().Err(err).Msg("No VFO info from rigctld, asking for frequency and mode separately")
+				vfoInfo = false
+				continue
+			}
+			if err == nil {
+				dial, err = parseFrequency(responses["Freq"])
+				mode = responses["Mode"]
+				passband, _ = strconv.Atoi(responses["Width"])
+			}
+		} else {
+			responses, err = command(conn, reader, "f")
+			if err == nil {
+				dial, err = parseFrequency(responses["Frequency"])
+			}
+			if err == nil {
+				responses, err = command(conn, reader, "m")
+				mode = responses["Mode"]
+				passband, _ = strconv.Atoi(responses["Passband"])
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		c.mutex.Lock()
+		c.dial, c.mode, c.passband, c.updated = dial, mode, passband, c.now()
+		c.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Send a command using the extended response protocol, which labels every value and ends with a result code:
+//
+//	get_freq:
+//	Frequency: 14074000
+//	RPRT 0
+func command(conn net.Conn, reader *bufio.Reader, cmd string) (map[string]string, error) {
+	if _, err := conn.Write([]byte("+" + cmd + "\n")); err != nil {
+		return nil, err
+	}
+
+	responses := make(map[string]string)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "RPRT ") {
+			if code := strings.TrimPrefix(line, "RPRT "); code != "0" {
+				return nil, fmt.Errorf("%w: %s returned %s", ErrCommand, cmd, code)
+			}
+			return responses, nil
+		}
+
+		if key, value, found := strings.Cut(line, ":"); found {
+			responses[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+}
+
+func parseFrequency(value string) (uint64, error) {
+	// Some backends report fractional hertz
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f <= 0 {
+		return 0, fmt.Errorf("%w: frequency %q", ErrCommand, value)
+	}
+	return uint64(f + 0.5), nil
+}
@@ -0,0 +1,125 @@
+package rigctl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A stand-in for rigctld, optionally for a rig without VFO info
+type fakeRigctld struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	vfoInfo  bool
+	dial     uint64
+	mode     string
+}
+
+func (f *fakeRigctld) serve(t *testing.T) {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+
+				f.mutex.Lock()
+				var response string
+				switch strings.TrimSpace(line) {
+				case `+\get_vfo_info currVFO`:
+					if f.vfoInfo {
+						response = fmt.Sprintf("get_vfo_info: currVFO\nFreq: %d\nMode: %s\nWidth: 3000\nSplit: 0\nSatMode: 0\nRPRT 0\n", f.dial, f.mode)
+					} else {
+						response = "RPRT -11\n"
+					}
+				case "+f":
+					response = fmt.Sprintf("get_freq:\nFrequency: %d\nRPRT 0\n", f.dial)
+				case "+m":
+					response = fmt.Sprintf("get_mode:\nMode: %s\nPassband: 2400\nRPRT 0\n", f.mode)
+				default:
+					t.Errorf("unexpected command %q", line)
+					response = "RPRT -1\n"
+				}
+				f.mutex.Unlock()
+
+				_, _ = conn.Write([]byte(response))
+			}
+		}()
+	}
+}
+
+func waitFor(client *Client, dial uint64) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if got, ok := client.DialFrequency(); ok && got == dial {
+			return true
+		}
+	}
+	return false
+}
+
+func TestClient(t *testing.T) {
+	for _, vfoInfo := range []bool{true, false} {
+		t.Run(fmt.Sprintf("vfoInfo=%v", vfoInfo), func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			fake := &fakeRigctld{listener: listener, vfoInfo: vfoInfo, dial: 14074000, mode: "PKTUSB"}
+			go fake.serve(t)
+
+			var (
+				client      = NewClient(listener.Addr().String())
+				ctx, cancel = context.WithCancel(context.Background())
+				stopped     = make(chan bool)
+			)
+			client.pollInterval = 5 * time.Millisecond
+			go func() {
+				_ = client.Run(ctx)
+				close(stopped)
+			}()
+			defer func() {
+				cancel()
+				<-stopped
+			}()
+
+			if _, ok := client.DialFrequency(); ok {
+				t.Error("expected no frequency before the first poll")
+			}
+			if !waitFor(client, 14074000) {
+				t.Fatal("frequency was not polled")
+			}
+			if mode, _, ok := client.Mode(); !ok || mode != "PKTUSB" {
+				t.Errorf("unexpected mode %q", mode)
+			}
+
+			// Band change
+			fake.mutex.Lock()
+			fake.dial = 7074000
+			fake.mutex.Unlock()
+			if !waitFor(client, 7074000) {
+				t.Error("band change was not noticed")
+			}
+
+			// Once rigctld goes away, the frequency can't be trusted for long
+			_ = listener.Close()
+			client.mutex.Lock()
+			client.now = func() time.Time { return time.Now().Add(2 * MaxAge) }
+			client.mutex.Unlock()
+			if _, ok := client.DialFrequency(); ok {
+				t.Error("expected a stale frequency to be ignored")
+			}
+		})
+	}
+}
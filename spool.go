@@ -0,0 +1,398 @@
+package spot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	SpoolFilename                = "spots.spool"
+	DefaultSpoolMaxBytes         = 16 * 1024 * 1024
+	spoolCompactBytes            = 64 * 1024 // An empty spool is started over once it has grown this big
+	spoolRecordHeaderLength      = 8
+	maxSpoolRecordLength         = 1024
+	spoolKindSpot           byte = 'S'
+	spoolKindSent           byte = 'A'
+)
+
+const (
+	SpoolSync_Always = iota // fsync after every append and every acknowledgement
+	SpoolSync_Flush         // fsync once per successfully sent message; survives a crashed process, not necessarily a crashed host
+	SpoolSync_Never         // Leave it to the operating system
+)
+
+var (
+	ErrSpoolFull   = errors.New("spool is full")
+	ErrSpoolClosed = errors.New("spool is closed")
+	ErrSpoolRecord = errors.New("spot is too big for the spool")
+)
+
+type SpoolOptions struct {
+	MaxAge   time.Duration // Unsent spots with a flowStartSeconds older than this are dropped on open; zero keeps everything
+	MaxBytes int64         // Upper limit for the spool file; zero means DefaultSpoolMaxBytes
+	Sync     int           // One of SpoolSync_*
+}
+
+// Spool is a write-ahead log of spots that have been fed but not yet sent.
+//
+// Spots are appended as they're fed, and marked sent once a message containing them has been written out.
+// The file is rewritten with only the unsent spots when it's opened, whenever it's about to outgrow MaxBytes, and
+// when every spot in a file of some size has been sent.
+type Spool struct {
+	mutex   sync.Mutex
+	path    string
+	options SpoolOptions
+	file    *os.File
+	size    int64
+	nextID  uint64
+	pending map[uint64]*Spot
+}
+
+// OpenSpool opens (or creates) a spool in dir, loading whatever was left unsent by a previous process
+func OpenSpool(dir string, options SpoolOptions) (*Spool, error) {
+	if options.MaxBytes == 0 {
+		options.MaxBytes = DefaultSpoolMaxBytes
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	spool := &Spool{
+		path:    filepath.Join(dir, SpoolFilename),
+		options: options,
+		nextID:  1,
+		pending: make(map[uint64]*Spot),
+	}
+
+	if err := spool.load(); err != nil {
+		return nil, err
+	}
+
+	// Drop whatever is too old to be worth reporting anymore
+	if options.MaxAge > 0 {
+		oldest := time.Now().Add(-options.MaxAge).Unix()
+		for id, spot := range spool.pending {
+			if int64(spot.flowStartSeconds) < oldest {
+				delete(spool.pending, id)
+			}
+		}
+	}
+
+	if err := spool.compact(); err != nil {
+		return nil, err
+	}
+
+	return spool, nil
+}
+
+// Pending returns the unsent spots in the order they were originally fed
+func (s *Spool) Pending() []*Spot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	spots := make([]*Spot, 0, len(s.pending))
+	for _, spot := range s.pending {
+		spots = append(spots, spot)
+	}
+	sort.Slice(spots, func(i, j int) bool {
+		return spots[i].spoolID < spots[j].spoolID
+	})
+
+	return spots
+}
+
+// Append records a spot as unsent
+func (s *Spool) Append(spot *Spot) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return ErrSpoolClosed
+	}
+
+	id := s.nextID
+	record, err := encodeSpoolRecord(spoolKindSpot, id, spot)
+	if err != nil {
+		return err
+	}
+
+	if s.size+int64(len(record)) > s.options.MaxBytes {
+		if err := s.compact(); err != nil {
+			return err
+		}
+		if s.size+int64(len(record)) > s.options.MaxBytes {
+			return fmt.Errorf("%w: %d bytes in %s", ErrSpoolFull, s.size, s.path)
+		}
+	}
+
+	if err := s.write(record, s.options.Sync == SpoolSync_Always); err != nil {
+		return err
+	}
+
+	s.nextID += 1
+	spot.spoolID = id
+	s.pending[id] = spot
+
+	return nil
+}
+
+// Sent records spots as successfully sent
+func (s *Spool) Sent(spots []*Spot) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return ErrSpoolClosed
+	}
+
+	var records []byte
+	for _, spot := range spots {
+		if _, ok := s.pending[spot.spoolID]; !ok {
+			continue
+		}
+		delete(s.pending, spot.spoolID)
+		record, err := encodeSpoolRecord(spoolKindSent, spot.spoolID, nil)
+		if err != nil {
+			return err
+		}
+		records = append(records, record...)
+	}
+
+	// Nothing left to remember, so start from scratch, once that's worth rewriting the file for
+	if len(s.pending) == 0 && s.size+int64(len(records)) >= spoolCompactBytes {
+		return s.compact()
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	return s.write(records, s.options.Sync != SpoolSync_Never)
+}
+
+func (s *Spool) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return ErrSpoolClosed
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+func (s *Spool) write(records []byte, sync bool) error {
+	n, err := s.file.Write(records)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	if sync {
+		return s.file.Sync()
+	}
+
+	return nil
+}
+
+// Read the spool file, leaving unsent spots in s.pending; a torn record at the end is ignored
+func (s *Spool) load() error {
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		kind, id, spot, err := decodeSpoolRecord(reader)
+		if err != nil {
+			// Whatever is after the first bad record can't be trusted
+			break
+		}
+
+		if id >= s.nextID {
+			s.nextID = id + 1
+		}
+
+		switch kind {
+		case spoolKindSpot:
+			spot.spoolID = id
+			s.pending[id] = spot
+		case spoolKindSent:
+			delete(s.pending, id)
+		}
+	}
+
+	return nil
+}
+
+// Replace the spool file with one that only has the unsent spots in it
+func (s *Spool) compact() error {
+	var records []byte
+	for id, spot := range s.pending {
+		record, err := encodeSpoolRecord(spoolKindSpot, id, spot)
+		if err != nil {
+			return err
+		}
+		records = append(records, record...)
+	}
+
+	temporary := s.path + ".tmp"
+	file, err := os.OpenFile(temporary, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(records); err == nil && s.options.Sync != SpoolSync_Never {
+		err = file.Sync()
+	}
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(temporary, s.path); err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		_ = s.file.Close()
+	}
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	s.size = int64(len(records))
+
+	return nil
+}
+
+// Length and checksum of the body, then kind, spot ID, and for spots the spot itself;
+// records that load() would refuse to read back are refused here already
+func encodeSpoolRecord(kind byte, id uint64, spot *Spot) ([]byte, error) {
+	var (
+		body []byte
+		ok   = true
+	)
+
+	body = append(body, kind)
+	body = binary.BigEndian.AppendUint64(body, id)
+	if spot != nil {
+		body, ok = appendSpoolString(body, spot.sender.Callsign, ok)
+		body, ok = appendSpoolString(body, spot.sender.Locator, ok)
+		body = binary.BigEndian.AppendUint64(body, spot.frequency)
+		body = append(body, byte(spot.snr), spot.imd)
+		body, ok = appendSpoolString(body, spot.mode, ok)
+		body = append(body, spot.informationSource)
+		body = binary.BigEndian.AppendUint32(body, spot.flowStartSeconds)
+		body = binary.BigEndian.AppendUint16(body, spot.dxcc)
+		body, ok = appendSpoolString(body, spot.region, ok)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: a string is over %d bytes", ErrSpoolRecord, math.MaxUint16)
+	}
+	if len(body) > maxSpoolRecordLength {
+		return nil, fmt.Errorf("%w: %d bytes", ErrSpoolRecord, len(body))
+	}
+
+	record := make([]byte, spoolRecordHeaderLength, spoolRecordHeaderLength+len(body))
+	binary.BigEndian.PutUint32(record[0:], uint32(len(body)))
+	binary.BigEndian.PutUint32(record[4:], crc32.ChecksumIEEE(body))
+
+	return append(record, body...), nil
+}
+
+func decodeSpoolRecord(reader io.Reader) (byte, uint64, *Spot, error) {
+	var header [spoolRecordHeaderLength]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return 0, 0, nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:])
+	if length > maxSpoolRecordLength {
+		return 0, 0, nil, errors.New("spool record is implausibly long")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return 0, 0, nil, err
+	}
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(header[4:]) {
+		return 0, 0, nil, errors.New("spool record checksum mismatch")
+	}
+	if len(body) < 9 {
+		return 0, 0, nil, io.ErrUnexpectedEOF
+	}
+
+	kind := body[0]
+	id := binary.BigEndian.Uint64(body[1:])
+	if kind != spoolKindSpot {
+		return kind, id, nil, nil
+	}
+
+	var (
+		spot = &Spot{}
+		ok   = true
+		rest = body[9:]
+	)
+	spot.sender.Callsign, rest, ok = consumeSpoolString(rest, ok)
+	spot.sender.Locator, rest, ok = consumeSpoolString(rest, ok)
+	if !ok || len(rest) < 10 {
+		return 0, 0, nil, io.ErrUnexpectedEOF
+	}
+	spot.frequency = binary.BigEndian.Uint64(rest[0:])
+	spot.snr = int8(rest[8])
+	spot.imd = rest[9]
+	spot.mode, rest, ok = consumeSpoolString(rest[10:], ok)
+	if !ok || len(rest) < 5 {
+		return 0, 0, nil, io.ErrUnexpectedEOF
+	}
+	spot.informationSource = rest[0]
+	spot.flowStartSeconds = binary.BigEndian.Uint32(rest[1:])
+	rest = rest[5:]
+
+	// Later additions, which older records don't have
+	if len(rest) >= 2 {
+		spot.dxcc = binary.BigEndian.Uint16(rest[0:])
+		spot.region, _, _ = consumeSpoolString(rest[2:], true)
+	}
+
+	return kind, id, spot, nil
+}
+
+func appendSpoolString(b []byte, s string, ok bool) ([]byte, bool) {
+	if !ok || len(s) > math.MaxUint16 {
+		return b, false
+	}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...), true
+}
+
+func consumeSpoolString(b []byte, ok bool) (string, []byte, bool) {
+	if !ok || len(b) < 2 {
+		return "", b, false
+	}
+	length := int(binary.BigEndian.Uint16(b[0:]))
+	if len(b) < 2+length {
+		return "", b, false
+	}
+	return string(b[2 : 2+length]), b[2+length:], true
+}
@@ -0,0 +1,207 @@
+package spot
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpool(t *testing.T) {
+	var (
+		dir = t.TempDir()
+		now = uint32(time.Now().Unix())
+	)
+
+	spool, err := OpenSpool(dir, SpoolOptions{Sync: SpoolSync_Always})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var spots []*Spot
+	for i := 0; i < 5; i++ {
+		spot := NewSpot("N1CALL", "II00OG", uint64(50313650+i), -3, 2, "FT8", 1, now).WithDXCC(uint16(i)).WithRegion("ON")
+		if err = spool.Append(spot); err != nil {
+			t.Fatal(err)
+		}
+		spots = append(spots, spot)
+	}
+	if err = spool.Sent([]*Spot{spots[1], spots[3]}); err != nil {
+		t.Fatal(err)
+	}
+	if err = spool.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a write that was cut short by a crash
+	file, err := os.OpenFile(filepath.Join(dir, SpoolFilename), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, _ := encodeSpoolRecord(spoolKindSpot, 99, spots[0])
+	_, _ = file.Write(record[:12])
+	_ = file.Close()
+
+	spool, err = OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+
+	pending := spool.Pending()
+	if len(pending) != 3 {
+		t.Fatalf("expected 3 pending spots, got %d", len(pending))
+	}
+	for i, want := range []*Spot{spots[0], spots[2], spots[4]} {
+		if *pending[i] != *want {
+			t.Errorf("pending spot %d: expected %+v, got %+v", i, *want, *pending[i])
+		}
+	}
+
+	// New spots must not collide with the replayed ones
+	spot := NewSpot("N2CALL", "II00OG", 50313650, -3, 2, "FT8", 1, now)
+	if err = spool.Append(spot); err != nil {
+		t.Fatal(err)
+	}
+	if spot.spoolID <= spots[4].spoolID {
+		t.Errorf("expected a fresh spool ID, got %d", spot.spoolID)
+	}
+
+	// Once everything has been sent, a file this small is left as it is
+	if err = spool.Sent(append(pending, spot)); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, SpoolFilename)); err != nil || info.Size() == 0 {
+		t.Errorf("expected the spool file to be left alone, got %+v, %v", info, err)
+	}
+
+	// ...but a bigger one is emptied
+	spots = nil
+	record, _ = encodeSpoolRecord(spoolKindSpot, 1, spot)
+	for i := 0; i*len(record) < spoolCompactBytes; i++ {
+		spot := NewSpot("N1CALL", "II00OG", 50313650, -3, 2, "FT8", 1, now)
+		if err = spool.Append(spot); err != nil {
+			t.Fatal(err)
+		}
+		spots = append(spots, spot)
+	}
+	if err = spool.Sent(spots); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, SpoolFilename)); err != nil || info.Size() != 0 {
+		t.Errorf("expected an empty spool file, got %+v, %v", info, err)
+	}
+}
+
+func TestSpotterSpoolReplay(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir(), SpoolOptions{Sync: SpoolSync_Never})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+	for i := 0; i < 5; i++ {
+		if err = spool.Append(NewSpot("N1CALL", "II00OG", uint64(50313650+i), -3, 2, "FT8", 1, 1670000000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The rest of the spool is queued as room frees up
+	spotter := newTestSpotter(t, SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, "", WithSpool(spool), WithQueueSize(2), WithFlushThresholds(2, time.Minute))
+	for _, want := range []int{5, 3} {
+		if spotter.queue.len() != 2 || spotter.QueueDepth() != want {
+			t.Fatalf("expected 2 queued of %d, got %d of %d", want, spotter.queue.len(), spotter.QueueDepth())
+		}
+		spotter.queue.pop()
+		spotter.queue.pop()
+		spotter.replaySpool()
+	}
+	if spot := spotter.queue.pop(); spot == nil || spot.frequency != 50313654 || spotter.QueueDepth() != 0 {
+		t.Errorf("expected the last spot spooled and nothing else, got %+v and %d", spot, spotter.QueueDepth())
+	}
+}
+
+func TestSpoolMaxAge(t *testing.T) {
+	dir := t.TempDir()
+
+	spool, err := OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = spool.Append(NewSpot("N1CALL", "II00OG", 50313650, -3, 2, "FT8", 1, uint32(time.Now().Add(-2*time.Hour).Unix())))
+	_ = spool.Append(NewSpot("N2CALL", "II00OG", 50313650, -3, 2, "FT8", 1, uint32(time.Now().Unix())))
+	_ = spool.Close()
+
+	spool, err = OpenSpool(dir, SpoolOptions{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+
+	pending := spool.Pending()
+	if len(pending) != 1 || pending[0].sender.Callsign != "N2CALL" {
+		t.Errorf("expected only the recent spot, got %+v", pending)
+	}
+}
+
+func TestSpoolMaxBytes(t *testing.T) {
+	spot := NewSpot("N1CALL", "II00OG", 50313650, -3, 2, "FT8", 1, 0)
+	record, err := encodeSpoolRecord(spoolKindSpot, 1, spot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	length := int64(len(record))
+
+	spool, err := OpenSpool(t.TempDir(), SpoolOptions{MaxBytes: 2 * length})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+
+	for i := 0; i < 2; i++ {
+		if err = spool.Append(NewSpot("N1CALL", "II00OG", 50313650, -3, 2, "FT8", 1, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = spool.Append(spot); !errors.Is(err, ErrSpoolFull) {
+		t.Errorf("expected %v, got %v", ErrSpoolFull, err)
+	}
+}
+
+func TestSpoolRecordTooBig(t *testing.T) {
+	dir := t.TempDir()
+
+	spool, err := OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, spot := range []*Spot{
+		NewSpot("N1CALL", "II00OG", 50313650, -3, 2, strings.Repeat("X", maxSpoolRecordLength), 1, 0),
+		NewSpot("N1CALL", "II00OG", 50313650, -3, 2, strings.Repeat("X", math.MaxUint16+1), 1, 0),
+	} {
+		if err = spool.Append(spot); !errors.Is(err, ErrSpoolRecord) {
+			t.Errorf("expected %v, got %v", ErrSpoolRecord, err)
+		}
+	}
+
+	// Spots after a refused one are still there after a restart
+	if err = spool.Append(NewSpot("N2CALL", "II00OG", 50313650, -3, 2, "FT8", 1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err = spool.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	spool, err = OpenSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+
+	if pending := spool.Pending(); len(pending) != 1 || pending[0].sender.Callsign != "N2CALL" {
+		t.Errorf("expected the spot after the refused ones, got %+v", pending)
+	}
+}
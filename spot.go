@@ -1,5 +1,14 @@
 package spot
 
+import (
+	"errors"
+	"fmt"
+	"github.com/kahara/go-pskreporter-spot/adif"
+	"github.com/kahara/go-pskreporter-spot/bandplan"
+	"github.com/kahara/go-pskreporter-spot/callsign"
+	"github.com/kahara/go-pskreporter-spot/maidenhead"
+)
+
 // From https://pskreporter.info/pskdev.html
 // IPFIX attribute IDs in parenthesis.
 
@@ -10,22 +19,53 @@ const (
 	SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart
 )
 
+// Values for informationSource; the bottom two bits say where the spot came from
+const (
+	InformationSource_AutomaticallyExtracted uint8 = 1
+	InformationSource_CallLog                uint8 = 2
+	InformationSource_ManualEntry            uint8 = 3
+	InformationSource_Test                   uint8 = 0x80 // Or'ed with one of the above for test transmissions
+)
+
 type Station struct {
 	Callsign string // (30351.{1,2}) "The callsign of the {sender,receiver} of the transmission"
 	Locator  string // (30351.{3,4}) "The locator of the {sender,receiver} of the transmission"
 }
 
+// Distance returns the great-circle distance in km to another station, going by their locators
+func (s Station) Distance(to Station) (float64, error) {
+	return maidenhead.Distance(s.Locator, to.Locator)
+}
+
+// Bearing returns the initial bearing in degrees from north to another station, going by their locators
+func (s Station) Bearing(to Station) (float64, error) {
+	return maidenhead.Bearing(s.Locator, to.Locator)
+}
+
+var ErrSpot = errors.New("invalid spot")
+
 type Spot struct {
 	sender            Station
-	frequency         uint64 // (30351.5) "The frequency of the transmission in Hertz"
-	snr               int8   // (30351.6) "The signal to noise ration of the transmission. Normally 1 byte"
-	imd               uint8  // (30351.7) "The intermodulation distortion of the transmission. Normally 1 byte."
-	mode              string // (30351.10) "The mode of the communication. One of the ADIF values for MODE or SUBMODE"
-	informationSource uint8  // (30351.11) "Identifies the source of the record. The bottom 2 bits have the following meaning: 1 = Automatically Extracted. 2 = From a Call Log (QSO). 3 = Other Manual Entry. The 0x80 bit indicates that this record is a test transmission. Normally 1 byte."
-	flowStartSeconds  uint32 // (150) "The time of the transmission (absolute seconds since 1/1/1970)"
+	frequency         uint64  // (30351.5) "The frequency of the transmission in Hertz"
+	snr               int8    // (30351.6) "The signal to noise ration of the transmission. Normally 1 byte"
+	imd               uint8   // (30351.7) "The intermodulation distortion of the transmission. Normally 1 byte."
+	mode              string  // (30351.10) "The mode of the communication. One of the ADIF values for MODE or SUBMODE"
+	informationSource uint8   // (30351.11) "Identifies the source of the record. The bottom 2 bits have the following meaning: 1 = Automatically Extracted. 2 = From a Call Log (QSO). 3 = Other Manual Entry. The 0x80 bit indicates that this record is a test transmission. Normally 1 byte."
+	flowStartSeconds  uint32  // (150) "The time of the transmission (absolute seconds since 1/1/1970)"
+	dxcc              uint16  // (30351.16) "The ADIF DXCC entity code of the sender", zero if unknown
+	region            string  // (30351.17) "The region (e.g. state, province) of the sender"
+	spoolID           uint64  // Non-zero once the spot has been written to a Spool
+	audioOffset       uint64  // Hz above the dial frequency...
+	pendingOffset     bool    // ...while it waits to be resolved by Feed
+	receiver          Station // Who heard it; fixed by Feed, so that a later receiver change doesn't apply to it
 }
 
+// NewSpot returns a Spot with mode in its ADIF form, such as "JS8" for "JS8Call", if it's a known mode
 func NewSpot(callsign string, locator string, frequency uint64, snr int8, imd uint8, mode string, informationSource uint8, flowStartSeconds uint32) *Spot {
+	if canonical, ok := adif.CanonicalMode(mode); ok {
+		mode = canonical
+	}
+
 	return &Spot{
 		sender: Station{
 			callsign,
@@ -39,3 +79,127 @@ func NewSpot(callsign string, locator string, frequency uint64, snr int8, imd ui
 		flowStartSeconds:  flowStartSeconds,
 	}
 }
+
+// WithDXCC sets the sender's ADIF DXCC entity code, for templates that include Field_SenderDXCCADIF
+func (s *Spot) WithDXCC(dxcc uint16) *Spot {
+	s.dxcc = dxcc
+	return s
+}
+
+// WithRegion sets the sender's region, for templates that include Field_SenderRegion
+func (s *Spot) WithRegion(region string) *Spot {
+	s.region = region
+	return s
+}
+
+// WithLocator sets the sender's locator
+func (s *Spot) WithLocator(locator string) *Spot {
+	s.sender.Locator = locator
+	return s
+}
+
+// WithMode sets the mode, in its ADIF form if it's a known mode as with NewSpot
+func (s *Spot) WithMode(mode string) *Spot {
+	if canonical, ok := adif.CanonicalMode(mode); ok {
+		mode = canonical
+	}
+	s.mode = mode
+	return s
+}
+
+// WithSNR sets the signal to noise ratio
+func (s *Spot) WithSNR(snr int8) *Spot {
+	s.snr = snr
+	return s
+}
+
+// WithAudioOffset makes the spot's frequency an offset from the rig's dial frequency, which is added to it when the
+// spot is fed to a Spotter with a FrequencySource
+func (s *Spot) WithAudioOffset(offset uint64) *Spot {
+	s.frequency = 0
+	s.audioOffset = offset
+	s.pendingOffset = true
+	return s
+}
+
+func (s *Spot) Sender() Station {
+	return s.sender
+}
+
+func (s *Spot) Frequency() uint64 {
+	return s.frequency
+}
+
+func (s *Spot) SNR() int8 {
+	return s.snr
+}
+
+func (s *Spot) IMD() uint8 {
+	return s.imd
+}
+
+func (s *Spot) Mode() string {
+	return s.mode
+}
+
+func (s *Spot) InformationSource() uint8 {
+	return s.informationSource
+}
+
+func (s *Spot) FlowStartSeconds() uint32 {
+	return s.flowStartSeconds
+}
+
+func (s *Spot) DXCC() uint16 {
+	return s.dxcc
+}
+
+func (s *Spot) Region() string {
+	return s.region
+}
+
+// Receiver is the station the spot was heard by; set when fed to a Spotter, or from the receiver record when decoded
+func (s *Spot) Receiver() Station {
+	return s.receiver
+}
+
+// Validate reports the first thing about the spot that would make it useless, or wrong, to send
+func (s *Spot) Validate() error {
+	switch {
+	case s.sender.Callsign == "":
+		return fmt.Errorf("%w: callsign is required", ErrSpot)
+	case !callsign.Valid(s.sender.Callsign):
+		return fmt.Errorf("%w: callsign %q", ErrSpot, s.sender.Callsign)
+	case s.frequency == 0 && !s.pendingOffset:
+		return fmt.Errorf("%w: frequency is required", ErrSpot)
+	case s.frequency != 0 && !bandplan.Plausible(s.frequency):
+		return fmt.Errorf("%w: frequency %d", ErrSpot, s.frequency)
+	case s.mode == "":
+		return fmt.Errorf("%w: mode is required", ErrSpot)
+	case s.sender.Locator != "" && !maidenhead.Valid(s.sender.Locator):
+		return fmt.Errorf("%w: locator %q", ErrSpot, s.sender.Locator)
+	}
+	return nil
+}
+
+// Normalize puts the sender's callsign and locator in their usual form, like "DL/K1ABC/P" and "FN42aa", leaving
+// alone whatever isn't valid and reporting the first of it
+func (s *Spot) Normalize() error {
+	var first error
+
+	if normalized, err := callsign.Normalize(s.sender.Callsign); err == nil {
+		s.sender.Callsign = normalized
+	} else {
+		first = fmt.Errorf("%w: %v", ErrSpot, err)
+	}
+
+	if s.sender.Locator != "" {
+		if normalized, err := maidenhead.Normalize(s.sender.Locator); err == nil {
+			s.sender.Locator = normalized
+		} else if first == nil {
+			first = fmt.Errorf("%w: %v", ErrSpot, err)
+		}
+	}
+
+	return first
+}
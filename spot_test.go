@@ -1,7 +1,142 @@
 package spot
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 func TestSpot(t *testing.T) {
-	t.Logf("FIXME implement the test")
+	spot := NewSpot("N1CALL", "II00og", 14074000, -3, 2, "JS8Call", InformationSource_CallLog, 1234).WithDXCC(291).WithRegion("MA")
+
+	if got := spot.Sender(); got != (Station{"N1CALL", "II00og"}) {
+		t.Errorf("unexpected sender %+v", got)
+	}
+	if spot.Frequency() != 14074000 || spot.SNR() != -3 || spot.IMD() != 2 || spot.InformationSource() != InformationSource_CallLog || spot.FlowStartSeconds() != 1234 {
+		t.Errorf("unexpected spot %+v", *spot)
+	}
+	if spot.Mode() != "JS8" || spot.DXCC() != 291 || spot.Region() != "MA" {
+		t.Errorf("unexpected mode %q, DXCC %d or region %q", spot.Mode(), spot.DXCC(), spot.Region())
+	}
+
+	spot.WithLocator("FN42").WithMode("ft4").WithSNR(10)
+	if spot.Sender().Locator != "FN42" || spot.Mode() != "FT4" || spot.SNR() != 10 {
+		t.Errorf("unexpected spot %+v", *spot)
+	}
+
+	spot.WithAudioOffset(1500)
+	if spot.Frequency() != 0 {
+		t.Errorf("expected the frequency to wait for the dial frequency, got %d", spot.Frequency())
+	}
+}
+
+func TestSpotNormalize(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		spot *Spot
+		want Station
+		err  error
+	}{
+		{"valid", NewSpot("dl/n1call/p", "ii00OG", 14074000, -3, 2, "FT8", 1, 0), Station{"DL/N1CALL/P", "II00og"}, nil},
+		{"no locator", NewSpot("n1call", "", 14074000, -3, 2, "FT8", 1, 0), Station{"N1CALL", ""}, nil},
+		{"short locator", NewSpot("N1CALL", "ii00", 14074000, -3, 2, "FT8", 1, 0), Station{"N1CALL", "II00"}, nil},
+		{"locator typo", NewSpot("n1call", "II00OGG", 14074000, -3, 2, "FT8", 1, 0), Station{"N1CALL", "II00OGG"}, ErrSpot},
+		{"hashed callsign", NewSpot("<...>", "ii00og", 14074000, -3, 2, "FT8", 1, 0), Station{"<...>", "II00og"}, ErrSpot},
+		{"no callsign", NewSpot("", "II00OG", 14074000, -3, 2, "FT8", 1, 0), Station{"", "II00og"}, ErrSpot},
+	} {
+		if err := tt.spot.Normalize(); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+		if got := tt.spot.Sender(); got != tt.want {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.want, got)
+		}
+	}
+}
+
+type dialFrequency struct {
+	frequency uint64
+	ok        bool
+}
+
+func (d *dialFrequency) DialFrequency() (uint64, bool) {
+	return d.frequency, d.ok
+}
+
+func TestSpotAudioOffset(t *testing.T) {
+	var (
+		rig     = &dialFrequency{14074000, true}
+		spotter = newTestSpotter(t, SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, "", WithFrequencySource(rig))
+	)
+
+	spotter.Feed(NewSpot("N1CALL", "II00OG", 0, -3, 2, "FT8", 1, 0).WithAudioOffset(1234))
+	rig.frequency = 7074000
+	spotter.Feed(NewSpot("N2CALL", "II00OG", 0, -3, 2, "FT8", 1, 0).WithAudioOffset(2000))
+	spotter.Feed(NewSpot("N3CALL", "II00OG", 10136000, -3, 2, "FT8", 1, 0))
+
+	// While the rig is gone, there's no telling where the spot was heard
+	rig.ok = false
+	spotter.Feed(NewSpot("N4CALL", "II00OG", 0, -3, 2, "FT8", 1, 0).WithAudioOffset(2000))
+
+	want := []*Spot{
+		NewSpot("N1CALL", "II00OG", 14075234, -3, 2, "FT8", 1, 0),
+		NewSpot("N2CALL", "II00OG", 7076000, -3, 2, "FT8", 1, 0),
+		NewSpot("N3CALL", "II00OG", 10136000, -3, 2, "FT8", 1, 0),
+	}
+	if spotter.queue.len() != len(want) {
+		t.Fatalf("expected %d spots, got %d", len(want), spotter.queue.len())
+	}
+	for i := range want {
+		want[i].receiver = spotter.Receiver()
+		if got := spotter.queue.pop(); *got != *want[i] {
+			t.Errorf("spot %d: expected %+v, got %+v", i, *want[i], *got)
+		}
+	}
+
+	// Without a frequency source, nothing can be resolved
+	spotter = newTestSpotter(t, SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, "")
+	spotter.Feed(NewSpot("N1CALL", "II00OG", 0, -3, 2, "FT8", 1, 0).WithAudioOffset(1234))
+	if spotter.queue.len() != 0 {
+		t.Errorf("expected the spot to be dropped")
+	}
+}
+
+func TestSpotValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		spot *Spot
+		err  error
+	}{
+		{"valid", NewSpot("N1CALL", "II00og", 14074000, -3, 2, "FT8", 1, 0), nil},
+		{"no locator", NewSpot("N1CALL", "", 14074000, -3, 2, "FT8", 1, 0), nil},
+		{"upper case locator", NewSpot("N1CALL", "II00OG", 14074000, -3, 2, "FT8", 1, 0), nil},
+		{"audio offset", NewSpot("N1CALL", "II00og", 0, -3, 2, "FT8", 1, 0).WithAudioOffset(1234), nil},
+		{"locator typo", NewSpot("N1CALL", "II00OGG", 14074000, -3, 2, "FT8", 1, 0), ErrSpot},
+		{"no callsign", NewSpot("", "II00og", 14074000, -3, 2, "FT8", 1, 0), ErrSpot},
+		{"hashed callsign", NewSpot("<...>", "II00og", 14074000, -3, 2, "FT8", 1, 0), ErrSpot},
+		{"callsign typo", NewSpot("N1-CALL", "II00og", 14074000, -3, 2, "FT8", 1, 0), ErrSpot},
+		{"no frequency", NewSpot("N1CALL", "II00og", 0, -3, 2, "FT8", 1, 0), ErrSpot},
+		{"audio offset for frequency", NewSpot("N1CALL", "II00og", 1234, -3, 2, "FT8", 1, 0), ErrSpot},
+		{"out of band", NewSpot("N1CALL", "II00og", 15000000, -3, 2, "FT8", 1, 0), nil},
+		{"no mode", NewSpot("N1CALL", "II00og", 14074000, -3, 2, "", 1, 0), ErrSpot},
+	} {
+		if err := tt.spot.Validate(); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestNewSpotMode(t *testing.T) {
+	for _, tt := range []struct {
+		mode string
+		want string
+	}{
+		{"FT8", "FT8"},
+		{"ft4", "FT4"},
+		{"JS8Call", "JS8"},
+		{"BPSK31", "PSK31"},
+		{"NEWMODE", "NEWMODE"}, // Left for the Spotter to deal with
+	} {
+		if got := NewSpot("N1CALL", "", 14074000, 0, 0, tt.mode, 1, 0).Mode(); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.mode, tt.want, got)
+		}
+	}
 }
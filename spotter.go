@@ -1,15 +1,24 @@
 package spot
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/dchest/uniuri"
+	"github.com/kahara/go-pskreporter-spot/adif"
+	"github.com/kahara/go-pskreporter-spot/bandplan"
+	"github.com/kahara/go-pskreporter-spot/maidenhead"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
+	"io"
 	"math/rand"
 	"net"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Defaults for the corresponding Config fields
 const (
 	QueueSize                        = 10000
 	MaxSpots                         = 25
@@ -19,152 +28,724 @@ const (
 	HeaderProbabilityLimit   float32 = 0.1
 	IPv4MaxPayloadBytes              = 576 - 60 - 8 - 20 // Minimum MTU - IP header - UDP header - additional headroom
 	IPv6MaxPayloadBytes              = 1280 - 40 - 8     // TODO Verify that this really is a reasonable assumption
+	TCPMaxPayloadBytes               = 65535             // Largest length an IPFIX message header can express
+	MinPayloadBytes                  = 256               // Room for descriptors and at least a few records
 )
 
+const (
+	ErrorsSize      = 16
+	ShutdownTimeout = 10 * time.Second // For Close
+)
+
+const (
+	Transport_UDP = iota
+	Transport_TCP // IPFIX messages are self-delimiting, so they can be written to the stream back to back
+)
+
+var ErrStarted = errors.New("spotter has already been started")
+
 // From https://pskreporter.info/pskdev.html
 // IPFIX attribute IDs in parenthesis.
 
 type Spotter struct {
-	receiver             Station
-	antennaInformation   string // (30351.9) "A freeform description of the receiving antenna"
-	decoderSoftware      string // (30351.8) "The name and version of the decoding software"
-	persistentIdentifier string // (30351.12) "Random string that identifies the sender. This may be used in the future as a primitive form of security."
-	randomIdentifier     uint32
-	sequenceNumber       uint32
-	headerProbability    float32
-	spotKind             int
-	ipfixDescriptors     []byte
-	queue                chan *Spot
-	lastFlush            time.Time
-	hostport             string
-	maxPayloadBytes      int
-	packetMetric         *prometheus.CounterVec
-	done                 chan bool
-	doneAck              chan bool
-}
-
-func NewSpotter(hostport string, callsign string, locator string, antennaInformation string, decoderSoftware string, persistentIdentifier string, spotKind int, packetMetric *prometheus.CounterVec) *Spotter {
+	receiver                 Station
+	antennaInformation       string // (30351.9) "A freeform description of the receiving antenna"
+	decoderSoftware          string // (30351.8) "The name and version of the decoding software"
+	rigInformation           string // (30351.13) "A freeform description of the receiving radio"
+	persistentIdentifier     string // (30351.12) "Random string that identifies the sender. This may be used in the future as a primitive form of security."
+	randomIdentifier         uint32
+	sequenceNumber           uint32
+	headerProbability        float32
+	headerProbabilityBackoff float32
+	headerProbabilityLimit   float32
+	frequencySource          FrequencySource
+	locatorProvider          LocatorProvider
+	receiverChanged          chan bool // Signals the run loop to send spots fed under the previous receiver
+	receiverTemplate         *Template
+	senderTemplate           *Template
+	ipfixDescriptors         []byte
+	queue                    *queue
+	spool                    *Spool
+	replay                   []*Spot // Spooled by a previous process, but not queued yet for lack of room
+	maxSpots                 int
+	lingerTime               time.Duration
+	lastFlush                time.Time
+	hostport                 string
+	transport                int
+	templatesSent            bool // Whether descriptors have been sent on the current stream connection
+	maxPayloadBytes          int
+	packetMetric             *prometheus.CounterVec
+	distanceMetric           *prometheus.HistogramVec
+	bandPlan                 bandplan.Plan
+	pipeline                 *pipeline
+	overflowMetric           *prometheus.CounterVec
+	overflowed               int // Spots dropped for lack of room in the queue
+	spotValidation           int
+	dedup                    *dedup // Nil unless deduplicating
+	unknownModes             int
+	flaggedModes             map[string]bool // Unknown modes already warned about
+	mutex                    sync.Mutex
+	cancel                   context.CancelFunc // Non-nil once started
+	stopping                 chan bool          // Closed when Shutdown is called
+	stopOnce                 sync.Once
+	stopped                  chan bool // Closed when the run loop exits
+	dropped                  int       // Spots left in queue when the run loop exited
+	err                      error
+	errors                   chan error
+	disabled                 error // Why NewSpotter couldn't make a working Spotter, which drops whatever it's fed
+}
+
+// NewSpotter is a shorthand for NewSpotterFromConfig followed by Start;
+// if the arguments don't make sense, it logs why and returns a Spotter that drops every spot, and whose Err says why
+func NewSpotter(hostport string, callsign string, locator string, antennaInformation string, decoderSoftware string, persistentIdentifier string, spotKind int, packetMetric *prometheus.CounterVec, options ...Option) *Spotter {
+	config := DefaultConfig()
+	config.Hostport = hostport
+	config.Callsign = callsign
+	config.Locator = locator
+	config.AntennaInformation = antennaInformation
+	config.DecoderSoftware = decoderSoftware
+	config.PersistentIdentifier = persistentIdentifier
+	config.SpotKind = spotKind
+	config.PacketMetric = packetMetric
+
+	spotter, err := NewSpotterFromConfig(config, options...)
+	if err != nil {
+		log.Error().Err(err).Msg("Spotter not created, every spot fed to it will be dropped")
+		return newDisabledSpotter(err)
+	}
+	_ = spotter.Start(context.Background())
+
+	return spotter
+}
+
+// NewSpotterFromConfig validates config, with options applied, and returns a Spotter that sends to config.Hostport once started
+func NewSpotterFromConfig(config Config, options ...Option) (*Spotter, error) {
+	for _, option := range options {
+		option(&config)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	receiverTemplate, senderTemplate := config.templates()
+
 	// For randomIdentifier
 	rand.Seed(time.Now().UnixNano())
 
 	// Compose a Spotter
 	spotter := Spotter{
 		receiver: Station{
-			callsign,
-			locator,
+			config.Callsign,
+			normalizeLocator(config.Locator),
 		},
-		antennaInformation:   antennaInformation,
-		decoderSoftware:      decoderSoftware,
-		persistentIdentifier: persistentIdentifier,
-		randomIdentifier:     rand.Uint32(), // "needed to deal with nasty cases of residential NAT/PAT gateways and DHCP"
-		sequenceNumber:       0,
-		headerProbability:    InitialHeaderProbability,
-		spotKind:             spotKind,
-		ipfixDescriptors:     []byte{},
-		queue:                make(chan *Spot, QueueSize),
-		lastFlush:            time.Now(),
-		hostport:             hostport,
-		maxPayloadBytes:      0,
-		packetMetric:         packetMetric,
-		done:                 make(chan bool, 1),
-		doneAck:              make(chan bool, 1),
+		antennaInformation:       config.AntennaInformation,
+		decoderSoftware:          config.DecoderSoftware,
+		rigInformation:           config.RigInformation,
+		frequencySource:          config.FrequencySource,
+		locatorProvider:          config.LocatorProvider,
+		receiverChanged:          make(chan bool, 1),
+		persistentIdentifier:     config.PersistentIdentifier,
+		randomIdentifier:         rand.Uint32(), // "needed to deal with nasty cases of residential NAT/PAT gateways and DHCP"
+		sequenceNumber:           0,
+		headerProbability:        config.InitialHeaderProbability,
+		headerProbabilityBackoff: config.HeaderProbabilityBackoff,
+		headerProbabilityLimit:   config.HeaderProbabilityLimit,
+		receiverTemplate:         receiverTemplate,
+		senderTemplate:           senderTemplate,
+		ipfixDescriptors:         []byte{},
+		spool:                    config.Spool,
+		maxSpots:                 config.MaxSpots,
+		lingerTime:               config.LingerTime,
+		lastFlush:                time.Now(),
+		hostport:                 config.Hostport,
+		transport:                config.Transport,
+		maxPayloadBytes:          config.MaxPayloadBytes,
+		packetMetric:             config.PacketMetric,
+		distanceMetric:           config.DistanceMetric,
+		bandPlan:                 config.BandPlan,
+		pipeline:                 newPipeline(config.Stages, config.FilterMetric),
+		overflowMetric:           config.OverflowMetric,
+		spotValidation:           config.SpotValidation,
+		unknownModes:             config.UnknownModes,
+		flaggedModes:             make(map[string]bool),
+		stopping:                 make(chan bool),
+		stopped:                  make(chan bool),
+		errors:                   make(chan error, ErrorsSize),
+	}
+
+	if spotter.bandPlan == nil {
+		spotter.bandPlan = bandplan.Worldwide
+	}
+	spotter.queue = newQueue(config.QueueSize, config.Overflow, spotter.bandPlan)
+	if config.DedupWindow > 0 {
+		spotter.dedup = newDedup(config.DedupWindow, config.DedupPolicy, spotter.bandPlan, config.SuppressedMetric)
 	}
 
 	// Construct IPFIX descriptors
-	if spotter.antennaInformation == "" {
-		spotter.ipfixDescriptors = append(spotter.ipfixDescriptors, ReceiverDescriptor_CallsignLocatorSoftware...)
-	} else {
-		spotter.ipfixDescriptors = append(spotter.ipfixDescriptors, ReceiverDescriptor_CallsignLocatorSoftwareAntenna...)
+	spotter.ipfixDescriptors = append(spotter.ipfixDescriptors, spotter.receiverTemplate.Bytes()...)
+	spotter.ipfixDescriptors = append(spotter.ipfixDescriptors, spotter.senderTemplate.Bytes()...)
+
+	// Unless configured explicitly, make some hopefully correct assumptions about how many bytes can be crammed into each packet without hitting MTU
+	if spotter.maxPayloadBytes == 0 {
+		if spotter.transport == Transport_TCP {
+			spotter.maxPayloadBytes = TCPMaxPayloadBytes
+		} else if strings.Count(spotter.hostport, ":") == 1 {
+			spotter.maxPayloadBytes = IPv4MaxPayloadBytes
+		} else {
+			spotter.maxPayloadBytes = IPv6MaxPayloadBytes
+		}
 	}
 
-	if spotter.spotKind == SpotKind_CallsignFrequencyModeSourceFlowstart {
-		spotter.ipfixDescriptors = append(spotter.ipfixDescriptors, SenderDescriptor_CallsignFrequencyModeSourceFlowstart...)
-	} else if spotter.spotKind == SpotKind_CallsignFrequencyModeSourceLocatorFlowstart {
-		spotter.ipfixDescriptors = append(spotter.ipfixDescriptors, SenderDescriptor_CallsignFrequencyModeSourceLocatorFlowstart...)
-	} else if spotter.spotKind == SpotKind_CallsignFrequencySNRIMDModeSourceFlowstart {
-		spotter.ipfixDescriptors = append(spotter.ipfixDescriptors, SenderDescriptor_CallsignFrequencySNRIMDModeSourceFlowstart...)
-	} else if spotter.spotKind == SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart {
-		spotter.ipfixDescriptors = append(spotter.ipfixDescriptors, SenderDescriptor_CallsignFrequencySNRIMDModeSourceLocatorFlowstart...)
+	// Generate a random 30351.12 "persistentIdentifier" if none was provided, keeping it around if asked to
+	if spotter.persistentIdentifier == "" && config.PersistentIdentifierFile != "" {
+		identifier, err := LoadPersistentIdentifier(config.PersistentIdentifierFile)
+		if err != nil {
+			return nil, err
+		}
+		spotter.persistentIdentifier = identifier
+	} else if spotter.persistentIdentifier == "" {
+		spotter.persistentIdentifier = uniuri.New()
 	}
 
-	// Make some hopefully correct assumptions about how many bytes can be crammed into each packet without hitting MTU
-	if strings.Count(spotter.hostport, ":") == 1 {
-		spotter.maxPayloadBytes = IPv4MaxPayloadBytes
-	} else {
-		spotter.maxPayloadBytes = IPv6MaxPayloadBytes
+	// Pick up where a previous process left off
+	if spotter.spool != nil {
+		spotter.replay = spotter.spool.Pending()
+		for _, spot := range spotter.replay {
+			spot.receiver = spotter.receiver
+		}
+		if left := spotter.replaySpool(); left > 0 {
+			log.Warn().Int("count", left).Msg("Queue is full, leaving the rest of the spool for later")
+		}
 	}
 
-	// Generate a random 30351.12 "persistentIdentifier" if none was provided
-	if spotter.persistentIdentifier == "" {
-		spotter.persistentIdentifier = uniuri.New()
+	return &spotter, nil
+}
+
+// A Spotter that never sends anything, for NewSpotter to return instead of nil
+func newDisabledSpotter(err error) *Spotter {
+	return &Spotter{
+		queue:        newQueue(0, Overflow_DropNewest, bandplan.Worldwide),
+		pipeline:     newPipeline(nil, nil),
+		bandPlan:     bandplan.Worldwide,
+		flaggedModes: make(map[string]bool),
+		stopping:     make(chan bool),
+		stopped:      make(chan bool),
+		errors:       make(chan error, ErrorsSize),
+		err:          err,
+		disabled:     err,
+	}
+}
+
+// Start sending spots until ctx is cancelled or Shutdown is called
+func (s *Spotter) Start(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.disabled != nil {
+		return s.disabled
+	}
+	if s.cancel != nil {
+		return ErrStarted
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	go s.run(ctx)
+
+	return nil
+}
+
+// Shutdown sends whatever is queued, giving up when ctx is done, and reports how many spots were left unsent
+func (s *Spotter) Shutdown(ctx context.Context) (int, error) {
+	s.mutex.Lock()
+	cancel := s.cancel
+	s.mutex.Unlock()
+
+	// Never started, so nothing could have been sent
+	if cancel == nil {
+		return s.queue.len(), nil
+	}
+
+	s.stopOnce.Do(func() {
+		close(s.stopping)
+	})
+
+	select {
+	case <-s.stopped:
+		return s.dropped, nil
+	case <-ctx.Done():
+		cancel()
+		<-s.stopped
+		return s.dropped, ctx.Err()
+	}
+}
+
+// Err returns the latest transport error, or nil if the latest attempt to send succeeded
+func (s *Spotter) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.err
+}
+
+// Receiver returns the station spots are reported as received by
+func (s *Spotter) Receiver() Station {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.receiver
+}
+
+// SetReceiver changes the station spots are reported as received by, such as when the operator changes callsign
+// or grid while running; spots already fed are sent under the previous receiver first
+func (s *Spotter) SetReceiver(receiver Station) error {
+	if receiver.Callsign == "" {
+		return fmt.Errorf("%w: callsign is required", ErrConfig)
+	}
+	if len(receiver.Callsign) > MaxStringLength || len(receiver.Locator) > MaxStringLength {
+		return fmt.Errorf("%w: receiver %+v is too long", ErrConfig, receiver)
+	}
+	if receiver.Locator != "" {
+		locator, err := maidenhead.Normalize(receiver.Locator)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrConfig, err)
+		}
+		receiver.Locator = locator
+	}
+
+	s.mutex.Lock()
+	changed := s.receiver != receiver
+	s.receiver = receiver
+	s.mutex.Unlock()
+
+	if changed {
+		select {
+		case s.receiverChanged <- true:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Ask the locator provider where the receiver is now
+func (s *Spotter) followLocator() {
+	if s.locatorProvider == nil {
+		return
+	}
+	locator, ok := s.locatorProvider.Locator()
+	if !ok {
+		return
+	}
+	locator = normalizeLocator(locator)
+
+	receiver := s.Receiver()
+	if locator == receiver.Locator {
+		return
 	}
+	log.Info().Str("callsign", receiver.Callsign).Str("from", receiver.Locator).Str("to", locator).Msg("Receiver locator changed")
+	receiver.Locator = locator
+	if err := s.SetReceiver(receiver); err != nil {
+		log.Err(err).Msg("Locator not taken into use")
+	}
+}
+
+// Errors delivers transport errors as they happen; errors nobody is waiting for are dropped
+func (s *Spotter) Errors() <-chan error {
+	return s.errors
+}
 
-	// Flush Spots if there are many of them, or if some time has passed since last flush
-	go func() {
-		const (
-			InitialDelay = 100
-			Backoff      = 2
-			Limit        = 10000
-		)
+func (s *Spotter) setErr(err error) {
+	s.mutex.Lock()
+	s.err = err
+	s.mutex.Unlock()
 
-		var (
-			err   error
-			delay time.Duration = InitialDelay
-			conn  net.Conn
-		)
+	if err != nil {
+		select {
+		case s.errors <- err:
+		default:
+		}
+	}
+}
+
+// Flush Spots if there are many of them, or if some time has passed since last flush
+func (s *Spotter) run(ctx context.Context) {
+	const (
+		InitialDelay = 100
+		Backoff      = 2
+		Limit        = 10000
+	)
 
+	var (
+		err    error
+		delay  time.Duration = InitialDelay
+		conn   net.Conn
+		dialer net.Dialer
+	)
+
+	defer func() {
+		s.dropped = s.pending()
+		if s.dropped > 0 {
+			log.Warn().Int("count", s.dropped).Str("callsign", s.Receiver().Callsign).Msg("Spotter stopped with unsent spots")
+		}
+		close(s.stopped)
+	}()
+
+	for {
+		// Prepare UDP "connection", or a real one for TCP
 		for {
-			// Prepare UDP "connection"
-			for {
-				conn, err = net.Dial("udp", spotter.hostport)
-				if err != nil {
-					log.Err(err).Msg("")
-					time.Sleep(delay * time.Millisecond)
-					delay *= Backoff
-					if delay > Limit {
-						delay = Limit
-					}
-					continue
-				} else {
-					break
-				}
+			// Nothing left to do
+			if s.isStopping() {
+				s.replaySpool()
+				s.releaseDedup(time.Time{})
+			}
+			if s.isStopping() && s.pending() == 0 {
+				return
 			}
 
-			// Send an initial packet which may contain just the descriptors
-			err = spotter.flush(conn)
+			conn, err = dialer.DialContext(ctx, s.network(), s.hostport)
 			if err != nil {
+				log.Err(err).Msg("")
+				s.setErr(err)
+				select {
+				case <-time.After(delay * time.Millisecond):
+				case <-ctx.Done():
+					return
+				}
+				delay *= Backoff
+				if delay > Limit {
+					delay = Limit
+				}
+				continue
+			} else {
 				break
 			}
+		}
+		delay = InitialDelay
+		s.templatesSent = false
 
-			// Start sending periodically
-			ticker := time.NewTicker(1 * time.Second)
-			for {
-				select {
-				case <-ticker.C:
-					if len(spotter.queue) >= MaxSpots || (time.Now().Sub(spotter.lastFlush) >= LingerTime && len(spotter.queue) > 0) {
-						err = spotter.flush(conn)
-						if err != nil {
-							break
-						}
-						spotter.lastFlush = time.Now()
+		// The collector never says anything back, so a read only returns once the stream has gone away
+		closed := make(chan bool)
+		if s.transport == Transport_TCP {
+			go func(conn net.Conn) {
+				_, _ = io.Copy(io.Discard, conn)
+				close(closed)
+			}(conn)
+		}
+
+		// Unblock any write in progress when giving up
+		connDone := make(chan bool)
+		go func(conn net.Conn) {
+			select {
+			case <-ctx.Done():
+				_ = conn.Close()
+			case <-connDone:
+			}
+		}(conn)
+
+		// Send an initial packet which may contain just the descriptors
+		err = s.flush(conn)
+		if err != nil {
+			log.Err(err).Str("hostport", s.hostport).Msg("Initial flush failed, reconnecting")
+			close(connDone)
+			_ = conn.Close()
+			continue
+		}
+
+		// Start sending periodically
+		ticker := time.NewTicker(1 * time.Second)
+	Connected:
+		for {
+			select {
+			case <-ticker.C:
+				s.followLocator()
+				s.replaySpool()
+				s.releaseDedup(time.Now())
+				if s.pending() >= s.maxSpots || (time.Now().Sub(s.lastFlush) >= s.lingerTime && s.pending() > 0) {
+					err = s.flush(conn)
+					if err != nil {
+						log.Err(err).Str("hostport", s.hostport).Msg("Flush failed, reconnecting")
+						break Connected
+					}
+					s.lastFlush = time.Now()
+				}
+			case <-s.receiverChanged:
+				err = s.flushPreviousReceivers(conn)
+				if err != nil {
+					log.Err(err).Str("hostport", s.hostport).Msg("Flush failed, reconnecting")
+					break Connected
+				}
+			case <-closed:
+				log.Warn().Str("hostport", s.hostport).Msg("Connection closed by reporter, reconnecting")
+				break Connected
+			case <-s.stopping:
+				// Drain the queue, and whatever deduplication is holding on to; Shutdown cancels ctx if this takes too long
+				for s.pending() > 0 {
+					s.replaySpool()
+					s.releaseDedup(time.Time{})
+					var progress bool
+					progress, err = s.flushSome(conn)
+					if err != nil {
+						log.Err(err).Str("hostport", s.hostport).Msg("Flush failed while shutting down, reconnecting")
+						break Connected
+					}
+					if !progress {
+						log.Warn().Int("count", s.pending()).Msg("Spots can't be sent, giving up on them")
+						break
 					}
-				case <-spotter.done:
-					// Attempt to shut down cleanly when done; this may or may not get everything written out in time
-					_ = spotter.flush(conn)
-					_ = conn.Close()
-					spotter.doneAck <- true
-					return
 				}
+				ticker.Stop()
+				close(connDone)
+				_ = conn.Close()
+				log.Debug().Str("callsign", s.Receiver().Callsign).Msg("Connection to reporter closed")
+				return
+			case <-ctx.Done():
+				ticker.Stop()
+				close(connDone)
+				_ = conn.Close()
+				return
 			}
 		}
-	}()
+		ticker.Stop()
+		close(connDone)
+		_ = conn.Close()
+	}
+}
+
+// How many spots are waiting to be sent
+func (s *Spotter) pending() int {
+	pending := s.queue.len()
+	if s.dedup != nil {
+		pending += s.dedup.len()
+	}
+
+	s.mutex.Lock()
+	pending += len(s.replay)
+	s.mutex.Unlock()
+
+	return pending
+}
+
+func (s *Spotter) isStopping() bool {
+	select {
+	case <-s.stopping:
+		return true
+	default:
+		return false
+	}
+}
 
-	return &spotter
+func (s *Spotter) network() string {
+	if s.transport == Transport_TCP {
+		return "tcp"
+	}
+	return "udp"
 }
 
-// Feed in a Spot to be sent later
+// Feed in a Spot to be sent later; when the queue is full, what happens depends on the overflow policy, and with
+// Overflow_Block, Feed waits for as long as it takes
 func (s *Spotter) Feed(spot *Spot) {
-	s.queue <- spot
+	_ = s.feed(context.Background(), spot, true)
+}
+
+// FeedContext is Feed that gives up waiting for room in the queue when ctx is done, returning ctx.Err()
+func (s *Spotter) FeedContext(ctx context.Context, spot *Spot) error {
+	return s.feed(ctx, spot, true)
+}
+
+// TryFeed is Feed that never waits, returning ErrQueueFull if the spot was dropped for lack of room, or ErrConfig if
+// NewSpotter couldn't make sense of its arguments; spots dropped for other reasons, such as by a filter, aren't errors
+func (s *Spotter) TryFeed(spot *Spot) error {
+	return s.feed(context.Background(), spot, false)
+}
+
+func (s *Spotter) feed(ctx context.Context, spot *Spot, wait bool) error {
+	if s.disabled != nil {
+		log.Debug().Str("callsign", spot.sender.Callsign).Msg("Spotter not created, dropping spot")
+		return s.disabled
+	}
+
+	if spot.pendingOffset {
+		if !s.resolveAudioOffset(spot) {
+			log.Warn().Str("callsign", spot.sender.Callsign).Uint64("offset", spot.audioOffset).Msg("Dial frequency unknown, dropping spot")
+			return nil
+		}
+	}
+
+	if !s.pipeline.run(spot) || !s.validate(spot) || !s.checkMode(spot) || !s.checkLength(spot) {
+		return nil
+	}
+
+	// Heard where the receiver is right now
+	s.followLocator()
+	spot.receiver = s.Receiver()
+
+	if s.distanceMetric != nil && spot.sender.Locator != "" {
+		if distance, err := spot.receiver.Distance(spot.sender); err == nil {
+			s.distanceMetric.WithLabelValues(s.bandPlan.Name(spot.frequency), spot.mode).Observe(distance)
+		}
+	}
+
+	// Spooled before deduplication holds on to it, so that a restart doesn't lose it either
+	if s.spool != nil {
+		if err := s.spool.Append(spot); err != nil {
+			log.Err(err).Msg("Spot could not be spooled")
+		}
+	}
+
+	if s.dedup != nil {
+		if suppressed := s.dedup.add(spot, time.Now()); suppressed != nil {
+			s.unspool(suppressed)
+		}
+		return nil
+	}
+	return s.enqueue(ctx, spot, wait)
+}
+
+// Queue a spot that has already been spooled
+func (s *Spotter) enqueue(ctx context.Context, spot *Spot, wait bool) error {
+	dropped, err := s.queue.push(ctx, spot, wait)
+	if dropped != nil {
+		log.Debug().Str("callsign", dropped.sender.Callsign).Msg("Queue is full, dropping spot")
+		s.overflow(dropped)
+	}
+	return err
+}
+
+// Account for a spot that was dropped for lack of room, in the queue or in a message
+func (s *Spotter) overflow(spot *Spot) {
+	s.unspool(spot)
+
+	s.mutex.Lock()
+	s.overflowed++
+	s.mutex.Unlock()
+
+	if s.overflowMetric != nil {
+		s.overflowMetric.WithLabelValues(s.bandPlan.Name(spot.frequency), spot.mode).Inc()
+	}
+}
+
+// Mark a spot that won't be sent as done with in the spool, so that it isn't sent after a restart either
+func (s *Spotter) unspool(spot *Spot) {
+	if s.spool == nil {
+		return
+	}
+	if err := s.spool.Sent([]*Spot{spot}); err != nil {
+		log.Err(err).Msg("Dropped spot could not be marked in spool")
+	}
+}
+
+// QueueDepth tells how many spots are waiting to be sent, including any held back for deduplication and any left in
+// the spool by a previous process
+func (s *Spotter) QueueDepth() int {
+	return s.pending()
+}
+
+// Overflowed tells how many spots have been dropped for lack of room in the queue, or for being too big to send at all
+func (s *Spotter) Overflowed() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.overflowed
+}
+
+// Queue spots left in the spool by a previous process, as far as there's room, and tell how many are still left
+func (s *Spotter) replaySpool() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for len(s.replay) > 0 && s.queue.free() > 0 {
+		_, _ = s.queue.push(context.Background(), s.replay[0], false)
+		s.replay[0] = nil
+		s.replay = s.replay[1:]
+	}
+	return len(s.replay)
+}
+
+// Queue the spots whose dedup window has passed by now, or all of them given a zero time, as far as there's room;
+// with deduplication on, this is the only thing queueing spots, so it won't block
+func (s *Spotter) releaseDedup(now time.Time) {
+	if s.dedup == nil {
+		return
+	}
+	for _, spot := range s.dedup.expired(now, s.queue.free()) {
+		_ = s.enqueue(context.Background(), spot, false)
+	}
+}
+
+// Tidy up the spot's callsign and locator, and tell whether the spot is good to send
+func (s *Spotter) validate(spot *Spot) bool {
+	if s.spotValidation == SpotValidation_Off {
+		return true
+	}
+
+	if err := spot.Normalize(); err != nil && s.spotValidation == SpotValidation_StripLocator && spot.sender.Locator != "" && !maidenhead.Valid(spot.sender.Locator) {
+		log.Debug().Str("callsign", spot.sender.Callsign).Str("locator", spot.sender.Locator).Msg("Invalid locator, sending spot without it")
+		spot.sender.Locator = ""
+	}
+
+	if err := spot.Validate(); err != nil {
+		log.Warn().Err(err).Str("callsign", spot.sender.Callsign).Msg("Dropping spot")
+		return false
+	}
+	return true
+}
+
+// Tell whether a spot's mode is good to send; modes that aren't in the ADIF registry may be new, or a decoder's own
+// name for something
+func (s *Spotter) checkMode(spot *Spot) bool {
+	if _, _, ok := adif.LookupMode(spot.mode); ok {
+		return true
+	}
+
+	if s.unknownModes == UnknownMode_Drop {
+		log.Debug().Str("callsign", spot.sender.Callsign).Str("mode", spot.mode).Msg("Unknown mode, dropping spot")
+		return false
+	}
+
+	s.mutex.Lock()
+	flagged := s.flaggedModes[spot.mode]
+	s.flaggedModes[spot.mode] = true
+	s.mutex.Unlock()
+	if !flagged {
+		log.Warn().Str("mode", spot.mode).Msg("Mode is not an ADIF MODE or SUBMODE, sending anyway")
+	}
+	return true
+}
+
+// Tell whether each of a spot's strings could fit in a message at all; one that can't would never get sent
+func (s *Spotter) checkLength(spot *Spot) bool {
+	for _, text := range []string{spot.sender.Callsign, spot.sender.Locator, spot.mode, spot.region} {
+		if len(text) > s.maxPayloadBytes {
+			log.Warn().Str("callsign", spot.sender.Callsign).Int("length", len(text)).Msg("Spot has a field too long to send, dropping")
+			return false
+		}
+	}
+	return true
+}
+
+// Locators are sent in the usual case, like "JN58td"; ones that aren't valid are left for validation to catch
+func normalizeLocator(locator string) string {
+	if normalized, err := maidenhead.Normalize(locator); err == nil {
+		return normalized
+	}
+	return locator
+}
+
+// Turn an audio offset into an RF frequency using the rig's current dial frequency
+func (s *Spotter) resolveAudioOffset(spot *Spot) bool {
+	if s.frequencySource == nil {
+		return false
+	}
+	dial, ok := s.frequencySource.DialFrequency()
+	if !ok {
+		return false
+	}
+
+	spot.frequency = dial + spot.audioOffset
+	spot.audioOffset = 0
+	spot.pendingOffset = false
+
+	return true
 }
 
 // Send Spots
@@ -175,47 +756,93 @@ func (s *Spotter) flush(conn net.Conn) error {
 		err         error
 		descriptors []byte
 		records     []byte
+		spots       []*Spot
 		datagram    []byte
 	)
 
-	// Include descriptors with steadily decreasing probability, down to a limit
-	// (RFC 5103 says they SHOULD always be sent when transport is UDP, but PSK Reporter has a different preference.)
-	if rand.Float32() < s.headerProbability {
-		descriptors = IPFIXDescriptors(s)
-	}
-
-	if s.headerProbability > HeaderProbabilityLimit {
-		s.headerProbability *= HeaderProbabilityBackoff
+	if s.transport == Transport_TCP {
+		// Over a stream the collector remembers templates, so they're sent once per connection
+		if !s.templatesSent {
+			descriptors = IPFIXDescriptors(s)
+		}
 	} else {
-		s.headerProbability = HeaderProbabilityLimit
+		// Include descriptors with steadily decreasing probability, down to a limit
+		// (RFC 5103 says they SHOULD always be sent when transport is UDP, but PSK Reporter has a different preference.)
+		if rand.Float32() < s.headerProbability {
+			descriptors = IPFIXDescriptors(s)
+		}
+
+		if s.headerProbability > s.headerProbabilityLimit {
+			s.headerProbability *= s.headerProbabilityBackoff
+		} else {
+			s.headerProbability = s.headerProbabilityLimit
+		}
 	}
 
 	// Get receiver and sender records, if any
-	records = IPFIXRecords(s, len(descriptors)+HeaderLength)
+	records, spots = ipfixRecords(s, len(descriptors)+HeaderLength)
 
 	// Combine everything into a packet
 	datagram = IPFIX(s.sequenceNumber, s.randomIdentifier, descriptors, records)
 
 	// Send packet
-	// FIXME figure out how to handle potentially unsent data when writing fails
 	_, err = conn.Write(datagram)
 	if s.packetMetric != nil {
 		s.packetMetric.WithLabelValues(conn.LocalAddr().Network(), conn.RemoteAddr().String()).Inc()
 	}
 	if err != nil {
+		// Nothing in the message can be assumed to have arrived, so put the spots back for the next attempt, ahead of
+		// the ones that came after them
+		s.queue.pushFront(spots...)
+		s.setErr(err)
 		return err
 	}
+	s.setErr(nil)
 
-	// FIXME related to the above remark about failing writes
+	if s.spool != nil {
+		if err = s.spool.Sent(spots); err != nil {
+			log.Err(err).Msg("Sent spots could not be marked in spool")
+		}
+	}
+
+	if descriptors != nil {
+		s.templatesSent = true
+	}
 	s.sequenceNumber += 1
 
 	return nil
 }
 
+// Send whatever was fed before the receiver changed, under the receiver record it was fed under
+func (s *Spotter) flushPreviousReceivers(conn net.Conn) error {
+	for spot := s.queue.peek(); spot != nil && spot.receiver != s.Receiver(); spot = s.queue.peek() {
+		progress, err := s.flushSome(conn)
+		if err != nil {
+			return err
+		}
+		s.lastFlush = time.Now()
+		if !progress {
+			break
+		}
+	}
+	return nil
+}
+
+// Flush, and tell whether that took the spot at the front of the queue; if it didn't, flushing again won't either
+func (s *Spotter) flushSome(conn net.Conn) (bool, error) {
+	head := s.queue.peek()
+	if err := s.flush(conn); err != nil {
+		return false, err
+	}
+	return head != nil && s.queue.peek() != head, nil
+}
+
+// Close is Shutdown with a ShutdownTimeout deadline
 func (s *Spotter) Close() {
-	s.done <- true
-	select {
-	case <-s.doneAck:
-		log.Debug().Str("callsign", s.receiver.Callsign).Msg("Connection to reporter closed")
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	if dropped, _ := s.Shutdown(ctx); dropped > 0 {
+		log.Warn().Int("count", dropped).Str("callsign", s.Receiver().Callsign).Msg("Spots left unsent on close")
 	}
 }
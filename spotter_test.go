@@ -1,7 +1,528 @@
 package spot_test
 
-import "testing"
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/kahara/go-pskreporter-spot"
+	"github.com/kahara/go-pskreporter-spot/bandplan"
+	"github.com/kahara/go-pskreporter-spot/spottest"
+	"github.com/prometheus/client_golang/prometheus"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
 
 func TestSpotter(t *testing.T) {
-	t.Logf("FIXME implement the test")
+	const SpotCount = 60
+
+	server, err := spottest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name      string
+		transport int
+		hostport  string
+	}{
+		{"UDP", spot.Transport_UDP, server.UDPAddr()},
+		{"TCP", spot.Transport_TCP, server.TCPAddr()},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(server.Spots())
+
+			spotter := spot.NewSpotter(tt.hostport, "N0CALL", "JJ00OG", "Dipole", "fakespot v0", "", spot.SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, nil, spot.WithTransport(tt.transport))
+			var spots []*spot.Spot
+			for i := 0; i < SpotCount; i++ {
+				s := spot.NewSpot("N1CALL", "II00OG", uint64(50313650+i), -3, 2, "FT8", 1, uint32(time.Now().UTC().Unix()))
+				spots = append(spots, s)
+				spotter.Feed(s)
+			}
+			spotter.Close()
+
+			if !server.WaitForSpots(before+SpotCount, 5*time.Second) {
+				t.Fatalf("expected %d spots, got %d", SpotCount, len(server.Spots())-before)
+			}
+			// A spot that doesn't fit in a packet goes first in the next one, so the order holds
+			for i, got := range server.Spots()[before:] {
+				if *got != *spots[i] {
+					t.Errorf("spot %d: expected %+v, got %+v", i, *spots[i], *got)
+				}
+			}
+
+			for _, receiver := range server.Receivers() {
+				if receiver.Callsign != "N0CALL" || receiver.AntennaInformation != "Dipole" || receiver.PersistentIdentifier == "" {
+					t.Errorf("unexpected receiver %+v", receiver)
+				}
+			}
+			if violations := server.Violations(); len(violations) != 0 {
+				t.Errorf("unexpected violations %+v", violations)
+			}
+		})
+	}
+}
+
+// Read back-to-back IPFIX messages from a stream until it's closed
+func readMessages(t *testing.T, conn net.Conn, decoder *spot.Decoder) []*spot.Message {
+	var (
+		messages []*spot.Message
+		reader   = bufio.NewReader(conn)
+	)
+
+	for {
+		datagram, err := spot.ReadMessage(reader)
+		if err != nil {
+			return messages
+		}
+		message, err := decoder.Decode(datagram)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, message)
+	}
+}
+
+func TestSpotterTCP(t *testing.T) {
+	const SpotCount = 30
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	spotter := spot.NewSpotter(listener.Addr().String(), "N0CALL", "JJ00OG", "", "fakespot v0", "", spot.SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, nil, spot.WithTransport(spot.Transport_TCP))
+
+	// Hang up on the first connection right after its initial message
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := readMessages(t, &deadlineConn{conn, 500 * time.Millisecond}, spot.NewDecoder())
+	_ = conn.Close()
+	if len(first) != 1 || len(first[0].Templates) != 2 {
+		t.Fatalf("expected one message with templates, got %+v", first)
+	}
+
+	// The spotter should come back and send the templates again
+	conn, err = listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for i := 0; i < SpotCount; i++ {
+		spotter.Feed(spot.NewSpot("N1CALL", "II00OG", uint64(50313650+i), -3, 2, "FT8", 1, uint32(time.Now().UTC().Unix())))
+	}
+	go spotter.Close()
+
+	messages := readMessages(t, conn, spot.NewDecoder())
+	if len(messages) == 0 || len(messages[0].Templates) != 2 {
+		t.Fatalf("expected templates in the first message after reconnecting, got %+v", messages)
+	}
+
+	count := 0
+	for i, message := range messages {
+		if i > 0 && len(message.Templates) != 0 {
+			t.Errorf("message %d repeats templates", i)
+		}
+		count += len(message.Spots)
+	}
+	if count != SpotCount {
+		t.Errorf("expected %d spots, got %d", SpotCount, count)
+	}
+}
+
+// Makes reads give up after a while, so that the test can move on from a connection
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(b)
+}
+
+func TestSpotterShutdown(t *testing.T) {
+	// Find a port nobody is listening on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostport := listener.Addr().String()
+	_ = listener.Close()
+
+	config := spot.DefaultConfig()
+	config.Hostport = hostport
+	config.Callsign = "N0CALL"
+	config.Locator = "JJ00OG"
+	config.DecoderSoftware = "fakespot v0"
+
+	spotter, err := spot.NewSpotterFromConfig(config, spot.WithTransport(spot.Transport_TCP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		spotter.Feed(spot.NewSpot("N1CALL", "II00OG", 50313650, -3, 2, "FT8", 1, uint32(time.Now().UTC().Unix())))
+	}
+
+	// Not started yet, so everything is left over
+	if dropped, err := spotter.Shutdown(context.Background()); dropped != 3 || err != nil {
+		t.Errorf("expected 3 dropped spots and no error, got %d and %v", dropped, err)
+	}
+
+	spotter, err = spot.NewSpotterFromConfig(config, spot.WithTransport(spot.Transport_TCP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = spotter.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err = spotter.Start(context.Background()); !errors.Is(err, spot.ErrStarted) {
+		t.Errorf("expected %v, got %v", spot.ErrStarted, err)
+	}
+	for i := 0; i < 3; i++ {
+		spotter.Feed(spot.NewSpot("N1CALL", "II00OG", 50313650, -3, 2, "FT8", 1, uint32(time.Now().UTC().Unix())))
+	}
+
+	select {
+	case <-spotter.Errors():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a transport error")
+	}
+	if spotter.Err() == nil {
+		t.Error("expected Err to report the failure")
+	}
+
+	// Nothing can be delivered, so Shutdown should give up at the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	dropped, err := spotter.Shutdown(ctx)
+	if dropped != 3 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected 3 dropped spots and %v, got %d and %v", context.DeadlineExceeded, dropped, err)
+	}
+
+	// Shutting down again returns right away
+	if dropped, err = spotter.Shutdown(context.Background()); dropped != 3 || err != nil {
+		t.Errorf("expected 3 dropped spots and no error, got %d and %v", dropped, err)
+	}
+}
+
+func TestSpotterSetReceiver(t *testing.T) {
+	server, err := spottest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	spotter := spot.NewSpotter(server.TCPAddr(), "N0CALL", "JJ00OG", "", "fakespot v0", "", spot.SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, nil, spot.WithTransport(spot.Transport_TCP))
+	for _, receiver := range []spot.Station{{}, {Callsign: "N0CALL", Locator: "JJ00OGG"}} {
+		if err = spotter.SetReceiver(receiver); !errors.Is(err, spot.ErrConfig) {
+			t.Errorf("%+v: expected %v, got %v", receiver, spot.ErrConfig, err)
+		}
+	}
+	if err = spotter.SetReceiver(spot.Station{Callsign: "N0CALL"}); err != nil {
+		t.Errorf("expected a receiver without a locator to do, got %v", err)
+	}
+	if err = spotter.SetReceiver(spot.Station{Callsign: "N0CALL/P", Locator: "JJ00OH"}); err != nil {
+		t.Fatal(err)
+	}
+	spotter.Feed(spot.NewSpot("N1CALL", "II00OG", 50313650, -3, 2, "FT8", 1, uint32(time.Now().UTC().Unix())))
+	spotter.Close()
+
+	if !server.WaitForSpots(1, 5*time.Second) {
+		t.Fatal("spot was not received")
+	}
+	receivers := server.Receivers()
+	if receiver := receivers[len(receivers)-1]; receiver.Station != spotter.Receiver() || receiver.Callsign != "N0CALL/P" {
+		t.Errorf("unexpected receiver %+v", receiver)
+	}
+}
+
+// A receiver that moves, and only knows where it is after a while
+type gps struct {
+	mutex   sync.Mutex
+	locator string
+}
+
+func (g *gps) Locator() (string, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.locator, g.locator != ""
+}
+
+func (g *gps) move(locator string) {
+	g.mutex.Lock()
+	g.locator = locator
+	g.mutex.Unlock()
+}
+
+func TestSpotterLocatorProvider(t *testing.T) {
+	server, err := spottest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	provider := &gps{}
+	spotter := spot.NewSpotter(server.TCPAddr(), "N0CALL/M", "JJ00OG", "", "fakespot v0", "", spot.SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, nil, spot.WithTransport(spot.Transport_TCP), spot.WithLocatorProvider(provider), spot.WithFlushThresholds(10, time.Hour))
+
+	now := uint32(time.Now().UTC().Unix())
+	spotter.Feed(spot.NewSpot("N1CALL", "II00OG", 50313650, -3, 2, "FT8", 1, now))
+	spotter.Feed(spot.NewSpot("N2CALL", "II00OG", 50313650, -3, 2, "FT8", 1, now))
+	provider.move("JJ00PG")
+	spotter.Feed(spot.NewSpot("N3CALL", "II00OG", 50313650, -3, 2, "FT8", 1, now))
+
+	// The move sends what was heard before it right away, without waiting for more spots
+	if !server.WaitForSpots(2, 5*time.Second) {
+		t.Fatal("spots from before the move were not sent")
+	}
+	spotter.Close()
+	if !server.WaitForSpots(3, 5*time.Second) {
+		t.Fatal("spot from after the move was not sent")
+	}
+
+	for i, want := range []string{"JJ00og", "JJ00og", "JJ00pg"} {
+		if got := server.Spots()[i].Receiver(); got.Locator != want || got.Callsign != "N0CALL/M" {
+			t.Errorf("spot %d: expected receiver locator %s, got %+v", i, want, got)
+		}
+	}
+	if receiver := spotter.Receiver(); receiver.Locator != "JJ00pg" {
+		t.Errorf("unexpected receiver %+v", receiver)
+	}
+}
+
+func TestSpotterDedup(t *testing.T) {
+	server, err := spottest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	spotter := spot.NewSpotter(server.TCPAddr(), "N0CALL", "JJ00OG", "", "fakespot v0", "", spot.SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, nil, spot.WithTransport(spot.Transport_TCP), spot.WithDedup(time.Hour, spot.DedupPolicy_BestSNR))
+
+	now := uint32(time.Now().UTC().Unix())
+	spotter.Feed(spot.NewSpot("N1CALL", "II00OG", 50313650, -15, 0, "FT8", 1, now))
+	spotter.Feed(spot.NewSpot("N1CALL", "II00OG", 50313650, -3, 0, "FT8", 1, now+15))
+	spotter.Feed(spot.NewSpot("N1CALL", "II00OG", 50313650, -9, 0, "FT8", 1, now+30))
+	spotter.Feed(spot.NewSpot("N2CALL", "II00OG", 50313650, -9, 0, "FT8", 1, now+30))
+
+	// Shutting down doesn't wait for the window to pass
+	spotter.Close()
+	if !server.WaitForSpots(2, 5*time.Second) {
+		t.Fatalf("expected 2 spots, got %d", len(server.Spots()))
+	}
+	if spots := server.Spots(); len(spots) != 2 || spots[0].SNR() != -3 || spots[1].Sender().Callsign != "N2CALL" {
+		t.Errorf("unexpected spots %+v", spots)
+	}
+}
+
+func TestSpotterOverflow(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		policy int
+		want   []string // Callsigns sent
+	}{
+		{"block", spot.Overflow_Block, []string{"N1CALL", "N2CALL"}},
+		{"drop newest", spot.Overflow_DropNewest, []string{"N1CALL", "N2CALL"}},
+		{"drop oldest", spot.Overflow_DropOldest, []string{"N3CALL", "N4CALL"}},
+		{"coalesce", spot.Overflow_Coalesce, []string{"N1CALL", "N2CALL"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := spottest.NewServer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer server.Close()
+
+			config := spot.DefaultConfig()
+			config.Hostport = server.TCPAddr()
+			config.Callsign = "N0CALL"
+			config.Locator = "JJ00OG"
+			config.DecoderSoftware = "fakespot v0"
+
+			spotter, err := spot.NewSpotterFromConfig(config, spot.WithTransport(spot.Transport_TCP), spot.WithQueueSize(2), spot.WithFlushThresholds(2, time.Minute), spot.WithOverflow(tt.policy))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Not started, so nothing gets taken from the queue
+			now := uint32(time.Now().UTC().Unix())
+			for _, callsign := range []string{"N1CALL", "N2CALL"} {
+				if err = spotter.TryFeed(spot.NewSpot(callsign, "II00OG", 50313650, -3, 0, "FT8", 1, now)); err != nil {
+					t.Fatalf("expected room for %s, got %v", callsign, err)
+				}
+			}
+			err = spotter.TryFeed(spot.NewSpot("N3CALL", "II00OG", 50313650, -3, 0, "FT8", 1, now))
+			if full := tt.policy != spot.Overflow_DropOldest; errors.Is(err, spot.ErrQueueFull) != full {
+				t.Errorf("expected full to be %v, got %v", full, err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err = spotter.FeedContext(ctx, spot.NewSpot("N4CALL", "II00OG", 50313650, -3, 0, "FT8", 1, now))
+			if tt.policy == spot.Overflow_Block && !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+			}
+
+			if spotter.QueueDepth() != 2 || spotter.Overflowed() != 2 {
+				t.Errorf("expected 2 spots queued and 2 dropped, got %d and %d", spotter.QueueDepth(), spotter.Overflowed())
+			}
+
+			if err = spotter.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			spotter.Close()
+			if !server.WaitForSpots(2, 5*time.Second) {
+				t.Fatalf("expected 2 spots, got %d", len(server.Spots()))
+			}
+			for i, s := range server.Spots() {
+				if s.Sender().Callsign != tt.want[i] {
+					t.Errorf("spot %d: expected %s, got %s", i, tt.want[i], s.Sender().Callsign)
+				}
+			}
+		})
+	}
+}
+
+// A Spotter that sends to a test server over TCP once it's closed, for tests that only look at what comes out
+func newServerSpotter(t *testing.T, options ...spot.Option) (*spot.Spotter, *spottest.Server) {
+	t.Helper()
+
+	server, err := spottest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+
+	options = append([]spot.Option{spot.WithTransport(spot.Transport_TCP), spot.WithFlushThresholds(100, time.Hour)}, options...)
+	spotter := spot.NewSpotter(server.TCPAddr(), "N0CALL", "JJ00OG", "", "fakespot v0", "", spot.SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, nil, options...)
+
+	return spotter, server
+}
+
+// Closes the Spotter and returns what the server got from it, failing unless that's count spots
+func closeServerSpotter(t *testing.T, spotter *spot.Spotter, server *spottest.Server, count int) []*spot.Spot {
+	t.Helper()
+
+	spotter.Close()
+	if !server.WaitForSpots(count, 5*time.Second) {
+		t.Fatalf("expected %d spots, got %d", count, len(server.Spots()))
+	}
+	spots := server.Spots()
+	if len(spots) != count {
+		t.Fatalf("expected %d spots, got %d", count, len(spots))
+	}
+	return spots
+}
+
+func TestSpotterValidation(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		spotValidation int
+		want           []spot.Station
+	}{
+		{"off", spot.SpotValidation_Off, []spot.Station{{"N1CALL", "II00OG"}, {"N2CALL", "II00OGG"}, {"", "II00og"}, {"<...>", ""}, {"dl/n4call/p", "ii00"}}},
+		{"strip locator", spot.SpotValidation_StripLocator, []spot.Station{{"N1CALL", "II00og"}, {"N2CALL", ""}, {"DL/N4CALL/P", "II00"}}},
+		{"strict", spot.SpotValidation_Strict, []spot.Station{{"N1CALL", "II00og"}, {"DL/N4CALL/P", "II00"}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			spotter, server := newServerSpotter(t, spot.WithSpotValidation(tt.spotValidation))
+
+			now := uint32(time.Now().UTC().Unix())
+			spotter.Feed(spot.NewSpot("N1CALL", "II00OG", 14074000, -3, 2, "FT8", 1, now))
+			spotter.Feed(spot.NewSpot("N2CALL", "II00OGG", 14074000, -3, 2, "FT8", 1, now))
+			spotter.Feed(spot.NewSpot("", "II00og", 14074000, -3, 2, "FT8", 1, now))
+			spotter.Feed(spot.NewSpot("<...>", "", 14074000, -3, 2, "FT8", 1, now))
+			spotter.Feed(spot.NewSpot("dl/n4call/p", "ii00", 14074000, -3, 2, "FT8", 1, now))
+
+			for i, s := range closeServerSpotter(t, spotter, server, len(tt.want)) {
+				if got := s.Sender(); got != tt.want[i] {
+					t.Errorf("spot %d: expected %+v, got %+v", i, tt.want[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestSpotterDistanceMetric(t *testing.T) {
+	var (
+		registry        = prometheus.NewRegistry()
+		metric          = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "spot_distance_km", Buckets: spot.DistanceBuckets}, []string{"band", "mode"})
+		spotter, server = newServerSpotter(t, spot.WithDistanceMetric(metric))
+		now             = uint32(time.Now().UTC().Unix())
+	)
+	registry.MustRegister(metric)
+
+	spotter.Feed(spot.NewSpot("N1CALL", "JJ00og", 14074000, -3, 2, "FT8", 1, now))
+	spotter.Feed(spot.NewSpot("N2CALL", "JJ10og", 14074000, -3, 2, "FT8", 1, now))
+	spotter.Feed(spot.NewSpot("N3CALL", "", 14074000, -3, 2, "FT8", 1, now)) // Can't tell how far
+	closeServerSpotter(t, spotter, server, 3)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 || len(families[0].GetMetric()) != 1 {
+		t.Fatalf("unexpected metrics %+v", families)
+	}
+	for _, label := range families[0].GetMetric()[0].GetLabel() {
+		if want := map[string]string{"band": "20m", "mode": "FT8"}[label.GetName()]; label.GetValue() != want {
+			t.Errorf("expected %s %q, got %q", label.GetName(), want, label.GetValue())
+		}
+	}
+	histogram := families[0].GetMetric()[0].GetHistogram()
+	// Two degrees of longitude at the equator
+	if histogram.GetSampleCount() != 2 || histogram.GetSampleSum() < 222 || histogram.GetSampleSum() > 223 {
+		t.Errorf("expected 2 spots 222 km in total, got %d and %f", histogram.GetSampleCount(), histogram.GetSampleSum())
+	}
+}
+
+func TestSpotterBandFilter(t *testing.T) {
+	spotter, server := newServerSpotter(t, spot.WithBandFilter(bandplan.Worldwide.From("6m")))
+
+	now := uint32(time.Now().UTC().Unix())
+	for _, frequency := range []uint64{14074000, 50313000, 60000000, 144174000} {
+		spotter.Feed(spot.NewSpot("N1CALL", "", frequency, -3, 2, "FT8", 1, now))
+	}
+
+	for i, s := range closeServerSpotter(t, spotter, server, 2) {
+		if want := []uint64{50313000, 144174000}[i]; s.Frequency() != want {
+			t.Errorf("expected %d, got %d", want, s.Frequency())
+		}
+	}
+	if counts := spotter.FilterCounts(); counts["band"] != (spot.FilterCount{Dropped: 2}) {
+		t.Errorf("expected the band stage to have dropped 2 spots, got %+v", counts)
+	}
+}
+
+func TestSpotterUnknownModes(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		unknownModes int
+		want         []string
+	}{
+		{"flag", spot.UnknownMode_Flag, []string{"FT8", "NEWMODE", "NEWMODE"}},
+		{"drop", spot.UnknownMode_Drop, []string{"FT8"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			spotter, server := newServerSpotter(t, spot.WithUnknownModes(tt.unknownModes))
+
+			now := uint32(time.Now().UTC().Unix())
+			spotter.Feed(spot.NewSpot("N1CALL", "", 14074000, -3, 2, "FT8", 1, now))
+			spotter.Feed(spot.NewSpot("N2CALL", "", 14074000, -3, 2, "NEWMODE", 1, now))
+			spotter.Feed(spot.NewSpot("N3CALL", "", 14074000, -3, 2, "NEWMODE", 1, now))
+
+			for i, s := range closeServerSpotter(t, spotter, server, len(tt.want)) {
+				if got := s.Mode(); got != tt.want[i] {
+					t.Errorf("spot %d: expected %q, got %q", i, tt.want[i], got)
+				}
+			}
+		})
+	}
 }
@@ -0,0 +1,59 @@
+package spottest
+
+import (
+	"github.com/kahara/go-pskreporter-spot"
+	"sync"
+	"time"
+)
+
+// Feeder is a spot.Feeder that keeps every spot fed to it, for testing the packages that feed spots; the zero value
+// is ready to use
+type Feeder struct {
+	mutex   sync.Mutex
+	spots   []*spot.Spot
+	changed chan bool // Closed, and replaced, whenever a spot is fed
+}
+
+func (f *Feeder) Feed(s *spot.Spot) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.spots = append(f.spots, s)
+	if f.changed != nil {
+		close(f.changed)
+		f.changed = nil
+	}
+}
+
+// Spots returns every spot fed so far, in order
+func (f *Feeder) Spots() []*spot.Spot {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return append([]*spot.Spot(nil), f.spots...)
+}
+
+// WaitForSpots blocks until at least count spots have been fed, returning false if that takes longer than timeout
+func (f *Feeder) WaitForSpots(count int, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		f.mutex.Lock()
+		if len(f.spots) >= count {
+			f.mutex.Unlock()
+			return true
+		}
+		if f.changed == nil {
+			f.changed = make(chan bool)
+		}
+		changed := f.changed
+		f.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return false
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package spottest
+
+import (
+	"github.com/kahara/go-pskreporter-spot"
+	"testing"
+	"time"
+)
+
+func TestFeeder(t *testing.T) {
+	var (
+		f    Feeder
+		want = []string{"N1CALL", "N2CALL", "N3CALL"}
+	)
+
+	if f.WaitForSpots(1, 10*time.Millisecond) {
+		t.Error("expected no spots yet")
+	}
+
+	go func() {
+		for _, callsign := range want {
+			f.Feed(spot.NewSpot(callsign, "", 14074000, -3, 0, "FT8", 1, 0))
+		}
+	}()
+	if !f.WaitForSpots(len(want), 5*time.Second) {
+		t.Fatalf("expected %d spots, got %d", len(want), len(f.Spots()))
+	}
+
+	spots := f.Spots()
+	if len(spots) != len(want) {
+		t.Fatalf("expected %d spots, got %d", len(want), len(spots))
+	}
+	for i, s := range spots {
+		if s.Sender().Callsign != want[i] {
+			t.Errorf("spot %d: expected %s, got %s", i, want[i], s.Sender().Callsign)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Package spottest provides a stand-in for PSK Reporter's collector, for testing Spotters without leaving the process
+package spottest
+
+import (
+	"bufio"
+	"github.com/kahara/go-pskreporter-spot"
+	"net"
+	"sync"
+	"time"
+)
+
+const MaxDatagramSize = 65535
+
+// Violation is something a client sent that PSK Reporter would not have accepted
+type Violation struct {
+	Network string // "udp" or "tcp"
+	Remote  string
+	Err     error
+}
+
+// Server listens for IPFIX on an ephemeral UDP and TCP port on the loopback interface, and keeps everything it decodes
+type Server struct {
+	udp        *net.UDPConn
+	tcp        net.Listener
+	wait       sync.WaitGroup
+	mutex      sync.Mutex
+	changed    *sync.Cond
+	closed     bool
+	conns      map[net.Conn]bool
+	messages   []*spot.Message
+	violations []Violation
+}
+
+func NewServer() (*Server, error) {
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the same port number for both, like the real thing does, if it happens to be free
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		tcp, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		_ = udp.Close()
+		return nil, err
+	}
+
+	server := &Server{
+		udp:   udp,
+		tcp:   tcp,
+		conns: make(map[net.Conn]bool),
+	}
+	server.changed = sync.NewCond(&server.mutex)
+
+	server.wait.Add(2)
+	go server.serveUDP()
+	go server.serveTCP()
+
+	return server, nil
+}
+
+// UDPAddr is the hostport to give a Spotter using Transport_UDP
+func (s *Server) UDPAddr() string {
+	return s.udp.LocalAddr().String()
+}
+
+// TCPAddr is the hostport to give a Spotter using Transport_TCP
+func (s *Server) TCPAddr() string {
+	return s.tcp.Addr().String()
+}
+
+// Messages returns every message decoded so far
+func (s *Server) Messages() []*spot.Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]*spot.Message(nil), s.messages...)
+}
+
+// Spots returns every spot received so far, in order of arrival
+func (s *Server) Spots() []*spot.Spot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var spots []*spot.Spot
+	for _, message := range s.messages {
+		spots = append(spots, message.Spots...)
+	}
+
+	return spots
+}
+
+// Receivers returns every receiver record received so far, in order of arrival
+func (s *Server) Receivers() []*spot.Receiver {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var receivers []*spot.Receiver
+	for _, message := range s.messages {
+		receivers = append(receivers, message.Receivers...)
+	}
+
+	return receivers
+}
+
+// Violations returns whatever couldn't be decoded so far
+func (s *Server) Violations() []Violation {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]Violation(nil), s.violations...)
+}
+
+// WaitForSpots blocks until at least count spots have been received, returning false if that takes longer than timeout
+func (s *Server) WaitForSpots(count int, timeout time.Duration) bool {
+	timer := time.AfterFunc(timeout, func() {
+		s.mutex.Lock()
+		s.changed.Broadcast()
+		s.mutex.Unlock()
+	})
+	defer timer.Stop()
+
+	deadline := time.Now().Add(timeout)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for {
+		received := 0
+		for _, message := range s.messages {
+			received += len(message.Spots)
+		}
+		if received >= count {
+			return true
+		}
+		if s.closed || !time.Now().Before(deadline) {
+			return false
+		}
+		s.changed.Wait()
+	}
+}
+
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.changed.Broadcast()
+	s.mutex.Unlock()
+
+	udpErr := s.udp.Close()
+	tcpErr := s.tcp.Close()
+	s.wait.Wait()
+
+	if udpErr != nil {
+		return udpErr
+	}
+	return tcpErr
+}
+
+func (s *Server) serveUDP() {
+	defer s.wait.Done()
+
+	// Templates are scoped to the exporter, so every source address gets its own decoder
+	decoders := make(map[string]*spot.Decoder)
+	buffer := make([]byte, MaxDatagramSize)
+
+	for {
+		n, remote, err := s.udp.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+
+		decoder := decoders[remote.String()]
+		if decoder == nil {
+			decoder = spot.NewDecoder()
+			decoders[remote.String()] = decoder
+		}
+
+		datagram := append([]byte(nil), buffer[:n]...)
+		message, err := decoder.Decode(datagram)
+		s.record("udp", remote.String(), message, err)
+	}
+}
+
+func (s *Server) serveTCP() {
+	defer s.wait.Done()
+
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns[conn] = true
+		s.mutex.Unlock()
+
+		s.wait.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+// Templates are scoped to the connection, so every one gets its own decoder
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wait.Done()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		_ = conn.Close()
+	}()
+
+	var (
+		decoder = spot.NewDecoder()
+		reader  = bufio.NewReader(conn)
+	)
+
+	for {
+		datagram, err := spot.ReadMessage(reader)
+		if err != nil {
+			return
+		}
+
+		message, err := decoder.Decode(datagram)
+		s.record("tcp", conn.RemoteAddr().String(), message, err)
+	}
+}
+
+func (s *Server) record(network string, remote string, message *spot.Message, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err != nil {
+		s.violations = append(s.violations, Violation{network, remote, err})
+	} else {
+		s.messages = append(s.messages, message)
+	}
+	s.changed.Broadcast()
+}
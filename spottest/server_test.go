@@ -0,0 +1,43 @@
+package spottest
+
+import (
+	"errors"
+	"github.com/kahara/go-pskreporter-spot"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServerViolations(t *testing.T) {
+	server, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	conn, err := net.Dial("udp", server.UDPAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Records without templates first, then something that isn't IPFIX at all
+	_, _ = conn.Write(spot.IPFIX(0, 1, nil, []byte{0x99, 0x93, 0x00, 0x08, 0x01, 0x02, 0x03, 0x04}))
+	_, _ = conn.Write([]byte("hello"))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(server.Violations()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	violations := server.Violations()
+	if len(violations) != 2 {
+		t.Fatalf("expected 2 violations, got %+v", violations)
+	}
+	if !errors.Is(violations[0].Err, spot.ErrUnknownTemplate) || !errors.Is(violations[1].Err, spot.ErrShortMessage) {
+		t.Errorf("unexpected violations %+v", violations)
+	}
+	if violations[0].Network != "udp" || violations[0].Remote != conn.LocalAddr().String() {
+		t.Errorf("unexpected origin %+v", violations[0])
+	}
+}
@@ -0,0 +1,241 @@
+package spot
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Fields PSK Reporter understands, with the lengths it expects (https://pskreporter.info/pskdev.html)
+var (
+	Field_SenderCallsign       = Field{Element_SenderCallsign, VariableLength, EnterpriseNumber}
+	Field_ReceiverCallsign     = Field{Element_ReceiverCallsign, VariableLength, EnterpriseNumber}
+	Field_SenderLocator        = Field{Element_SenderLocator, VariableLength, EnterpriseNumber}
+	Field_ReceiverLocator      = Field{Element_ReceiverLocator, VariableLength, EnterpriseNumber}
+	Field_Frequency            = Field{Element_Frequency, 4, EnterpriseNumber}
+	Field_SNR                  = Field{Element_SNR, 1, EnterpriseNumber}
+	Field_IMD                  = Field{Element_IMD, 1, EnterpriseNumber}
+	Field_DecoderSoftware      = Field{Element_DecoderSoftware, VariableLength, EnterpriseNumber}
+	Field_AntennaInformation   = Field{Element_AntennaInformation, VariableLength, EnterpriseNumber}
+	Field_Mode                 = Field{Element_Mode, VariableLength, EnterpriseNumber}
+	Field_InformationSource    = Field{Element_InformationSource, 1, EnterpriseNumber}
+	Field_PersistentIdentifier = Field{Element_PersistentIdentifier, VariableLength, EnterpriseNumber}
+	Field_RigInformation       = Field{Element_RigInformation, VariableLength, EnterpriseNumber}
+	Field_SenderDXCCADIF       = Field{Element_SenderDXCCADIF, 2, EnterpriseNumber}
+	Field_SenderRegion         = Field{Element_SenderRegion, VariableLength, EnterpriseNumber}
+	Field_FlowStartSeconds     = Field{Element_FlowStartSeconds, 4, 0}
+)
+
+// Which fields can go into which kind of record
+var (
+	allowedReceiverFields = []Field{Field_ReceiverCallsign, Field_ReceiverLocator, Field_DecoderSoftware, Field_AntennaInformation, Field_PersistentIdentifier, Field_RigInformation}
+	allowedSenderFields   = []Field{Field_SenderCallsign, Field_SenderLocator, Field_Frequency, Field_SNR, Field_IMD, Field_Mode, Field_InformationSource, Field_FlowStartSeconds, Field_SenderDXCCADIF, Field_SenderRegion}
+)
+
+const (
+	ReceiverTemplateID = 0x9992
+	SenderTemplateID   = 0x9993
+)
+
+// Templates matching the hand-written descriptors PSK Reporter's documentation shows
+var (
+	ReceiverTemplate_CallsignLocatorSoftware                         = NewOptionsTemplate(ReceiverTemplateID, Field_ReceiverCallsign, Field_ReceiverLocator, Field_DecoderSoftware)
+	ReceiverTemplate_CallsignLocatorSoftwareAntenna                  = NewOptionsTemplate(ReceiverTemplateID, Field_ReceiverCallsign, Field_ReceiverLocator, Field_DecoderSoftware, Field_AntennaInformation)
+	ReceiverTemplate_CallsignLocatorSoftwareIdentifier               = NewOptionsTemplate(ReceiverTemplateID, Field_ReceiverCallsign, Field_ReceiverLocator, Field_DecoderSoftware, Field_PersistentIdentifier)
+	ReceiverTemplate_CallsignLocatorSoftwareAntennaIdentifier        = NewOptionsTemplate(ReceiverTemplateID, Field_ReceiverCallsign, Field_ReceiverLocator, Field_DecoderSoftware, Field_AntennaInformation, Field_PersistentIdentifier)
+	SenderTemplate_CallsignFrequencyModeSourceFlowstart              = NewTemplate(SenderTemplateID, SenderFields(SpotKind_CallsignFrequencyModeSourceFlowstart)...)
+	SenderTemplate_CallsignFrequencyModeSourceLocatorFlowstart       = NewTemplate(SenderTemplateID, SenderFields(SpotKind_CallsignFrequencyModeSourceLocatorFlowstart)...)
+	SenderTemplate_CallsignFrequencySNRIMDModeSourceFlowstart        = NewTemplate(SenderTemplateID, SenderFields(SpotKind_CallsignFrequencySNRIMDModeSourceFlowstart)...)
+	SenderTemplate_CallsignFrequencySNRIMDModeSourceLocatorFlowstart = NewTemplate(SenderTemplateID, SenderFields(SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart)...)
+)
+
+// SenderFields returns the fields of one of the predefined SpotKind_* combinations
+func SenderFields(spotKind int) []Field {
+	switch spotKind {
+	case SpotKind_CallsignFrequencyModeSourceFlowstart:
+		return []Field{Field_SenderCallsign, Field_Frequency, Field_Mode, Field_InformationSource, Field_FlowStartSeconds}
+	case SpotKind_CallsignFrequencyModeSourceLocatorFlowstart:
+		return []Field{Field_SenderCallsign, Field_Frequency, Field_Mode, Field_InformationSource, Field_SenderLocator, Field_FlowStartSeconds}
+	case SpotKind_CallsignFrequencySNRIMDModeSourceFlowstart:
+		return []Field{Field_SenderCallsign, Field_Frequency, Field_SNR, Field_IMD, Field_Mode, Field_InformationSource, Field_FlowStartSeconds}
+	case SpotKind_CallsignFrequencySNRIMDModeSourceLocatorFlowstart:
+		return []Field{Field_SenderCallsign, Field_Frequency, Field_SNR, Field_IMD, Field_Mode, Field_InformationSource, Field_SenderLocator, Field_FlowStartSeconds}
+	}
+	return nil
+}
+
+// ReceiverFields returns the fields for a receiver record, depending on whether antenna information is available
+func ReceiverFields(antennaInformation bool) []Field {
+	if antennaInformation {
+		return []Field{Field_ReceiverCallsign, Field_ReceiverLocator, Field_DecoderSoftware, Field_AntennaInformation, Field_PersistentIdentifier}
+	}
+	return []Field{Field_ReceiverCallsign, Field_ReceiverLocator, Field_DecoderSoftware, Field_PersistentIdentifier}
+}
+
+func NewTemplate(id uint16, fields ...Field) *Template {
+	return &Template{
+		ID:     id,
+		Fields: fields,
+	}
+}
+
+// NewOptionsTemplate returns a template that goes into an options template set, like receiver templates do
+func NewOptionsTemplate(id uint16, fields ...Field) *Template {
+	return &Template{
+		ID:      id,
+		Options: true,
+		Fields:  fields,
+	}
+}
+
+// Bytes returns the template as a complete (options) template set, padded to a 4-byte boundary
+func (t *Template) Bytes() []byte {
+	var set []byte
+
+	if t.Options {
+		set = binary.BigEndian.AppendUint16(set, OptionsTemplateSetID)
+	} else {
+		set = binary.BigEndian.AppendUint16(set, TemplateSetID)
+	}
+	set = append(set, 0, 0) // Length, filled in below
+
+	set = binary.BigEndian.AppendUint16(set, t.ID)
+	set = binary.BigEndian.AppendUint16(set, uint16(len(t.Fields)))
+	if t.Options {
+		set = binary.BigEndian.AppendUint16(set, t.ScopeFieldCount)
+	}
+
+	for _, field := range t.Fields {
+		if field.EnterpriseNumber != 0 {
+			set = binary.BigEndian.AppendUint16(set, field.ElementID|enterpriseBit)
+			set = binary.BigEndian.AppendUint16(set, field.Length)
+			set = binary.BigEndian.AppendUint32(set, field.EnterpriseNumber)
+		} else {
+			set = binary.BigEndian.AppendUint16(set, field.ElementID)
+			set = binary.BigEndian.AppendUint16(set, field.Length)
+		}
+	}
+
+	for len(set)%4 != 0 {
+		set = append(set, 0)
+	}
+	binary.BigEndian.PutUint16(set[2:], uint16(len(set)))
+
+	return set
+}
+
+// Check that every field is one that can be filled in from the given kind of record, and only once
+func (t *Template) validate(allowed []Field, required Field) error {
+	seen := make(map[Field]bool)
+
+	for _, field := range t.Fields {
+		var known *Field
+		for i := range allowed {
+			if allowed[i].key() == field.key() {
+				known = &allowed[i]
+			}
+		}
+		if known == nil {
+			return fmt.Errorf("%w: field %+v can't be used in template 0x%04X", ErrTemplate, field, t.ID)
+		}
+
+		// Text has to be variable-length, numbers have to fit in a uint64
+		if (known.Length == VariableLength) != (field.Length == VariableLength) || (field.Length != VariableLength && (field.Length < 1 || field.Length > 8)) {
+			return fmt.Errorf("%w: field %+v has an unusable length in template 0x%04X", ErrTemplate, field, t.ID)
+		}
+
+		if seen[field.key()] {
+			return fmt.Errorf("%w: field %+v is repeated in template 0x%04X", ErrTemplate, field, t.ID)
+		}
+		seen[field.key()] = true
+	}
+
+	if !seen[required.key()] {
+		return fmt.Errorf("%w: template 0x%04X lacks field %+v", ErrTemplate, t.ID, required)
+	}
+
+	return nil
+}
+
+// Identifies the information element regardless of its length
+func (f Field) key() Field {
+	f.Length = 0
+	return f
+}
+
+// A value for a field; text for variable-length fields, a number for the others
+type fieldValue struct {
+	text   string
+	number uint64
+}
+
+// Append a data record with a value for each field of the template
+func (t *Template) appendRecord(record []byte, value func(Field) fieldValue) []byte {
+	for _, field := range t.Fields {
+		v := value(field)
+
+		if field.Length == VariableLength {
+			// Short strings get a one-byte length, longer ones a marker followed by a two-byte length
+			if len(v.text) < longVariableLengthTag {
+				record = append(record, uint8(len(v.text)))
+			} else {
+				record = append(record, longVariableLengthTag)
+				record = binary.BigEndian.AppendUint16(record, uint16(len(v.text)))
+			}
+			record = append(record, v.text...)
+			continue
+		}
+
+		// Reduced-size encoding keeps the least significant bytes
+		for i := int(field.Length) - 1; i >= 0; i-- {
+			record = append(record, byte(v.number>>(8*i)))
+		}
+	}
+
+	return record
+}
+
+func (s *Spot) fieldValue(field Field) fieldValue {
+	switch field.key() {
+	case Field_SenderCallsign.key():
+		return fieldValue{text: s.sender.Callsign}
+	case Field_SenderLocator.key():
+		return fieldValue{text: s.sender.Locator}
+	case Field_Frequency.key():
+		return fieldValue{number: s.frequency}
+	case Field_SNR.key():
+		return fieldValue{number: uint64(uint8(s.snr))}
+	case Field_IMD.key():
+		return fieldValue{number: uint64(s.imd)}
+	case Field_Mode.key():
+		return fieldValue{text: s.mode}
+	case Field_InformationSource.key():
+		return fieldValue{number: uint64(s.informationSource)}
+	case Field_FlowStartSeconds.key():
+		return fieldValue{number: uint64(s.flowStartSeconds)}
+	case Field_SenderDXCCADIF.key():
+		return fieldValue{number: uint64(s.dxcc)}
+	case Field_SenderRegion.key():
+		return fieldValue{text: s.region}
+	}
+	return fieldValue{}
+}
+
+func (s *Spotter) receiverFieldValue(receiver Station) func(Field) fieldValue {
+	return func(field Field) fieldValue {
+		switch field.key() {
+		case Field_ReceiverCallsign.key():
+			return fieldValue{text: receiver.Callsign}
+		case Field_ReceiverLocator.key():
+			return fieldValue{text: receiver.Locator}
+		case Field_DecoderSoftware.key():
+			return fieldValue{text: s.decoderSoftware}
+		case Field_AntennaInformation.key():
+			return fieldValue{text: s.antennaInformation}
+		case Field_PersistentIdentifier.key():
+			return fieldValue{text: s.persistentIdentifier}
+		case Field_RigInformation.key():
+			return fieldValue{text: s.rigInformation}
+		}
+		return fieldValue{}
+	}
+}
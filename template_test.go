@@ -0,0 +1,111 @@
+package spot
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTemplateBytes(t *testing.T) {
+	// These used to be written out by hand
+	for _, tt := range []struct {
+		name     string
+		template *Template
+		want     []byte
+	}{
+		{"ReceiverDescriptor_CallsignLocatorSoftware", ReceiverTemplate_CallsignLocatorSoftware, []byte{
+			0x00, 0x03, 0x00, 0x24, 0x99, 0x92, 0x00, 0x03, 0x00, 0x00,
+			0x80, 0x02, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
+			0x80, 0x04, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
+			0x80, 0x08, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
+			0x00, 0x00,
+		}},
+		{"ReceiverDescriptor_CallsignLocatorSoftwareAntennaIdentifier", ReceiverTemplate_CallsignLocatorSoftwareAntennaIdentifier, []byte{
+			0x00, 0x03, 0x00, 0x34, 0x99, 0x92, 0x00, 0x05, 0x00, 0x00,
+			0x80, 0x02, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
+			0x80, 0x04, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
+			0x80, 0x08, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
+			0x80, 0x09, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
+			0x80, 0x0C, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
+			0x00, 0x00,
+		}},
+		{"SenderDescriptor_CallsignFrequencyModeSourceFlowstart", SenderTemplate_CallsignFrequencyModeSourceFlowstart, []byte{
+			0x00, 0x02, 0x00, 0x2C, 0x99, 0x93, 0x00, 0x05,
+			0x80, 0x01, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
+			0x80, 0x05, 0x00, 0x04, 0x00, 0x00, 0x76, 0x8F,
+			0x80, 0x0A, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
+			0x80, 0x0B, 0x00, 0x01, 0x00, 0x00, 0x76, 0x8F,
+			0x00, 0x96, 0x00, 0x04,
+		}},
+		{"SenderDescriptor_CallsignFrequencySNRIMDModeSourceLocatorFlowstart", SenderTemplate_CallsignFrequencySNRIMDModeSourceLocatorFlowstart, []byte{
+			0x00, 0x02, 0x00, 0x44, 0x99, 0x93, 0x00, 0x08,
+			0x80, 0x01, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
+			0x80, 0x05, 0x00, 0x04, 0x00, 0x00, 0x76, 0x8F,
+			0x80, 0x06, 0x00, 0x01, 0x00, 0x00, 0x76, 0x8F,
+			0x80, 0x07, 0x00, 0x01, 0x00, 0x00, 0x76, 0x8F,
+			0x80, 0x0A, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
+			0x80, 0x0B, 0x00, 0x01, 0x00, 0x00, 0x76, 0x8F,
+			0x80, 0x03, 0xFF, 0xFF, 0x00, 0x00, 0x76, 0x8F,
+			0x00, 0x96, 0x00, 0x04,
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.template.Bytes(); !bytes.Equal(got, tt.want) {
+				t.Errorf("expected % X, got % X", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTemplateCustomFields(t *testing.T) {
+	var (
+		receiverFields = []Field{Field_ReceiverLocator, Field_ReceiverCallsign, Field_AntennaInformation}
+		senderFields   = []Field{Field_FlowStartSeconds, Field_SNR, Field_SenderCallsign, {Element_Frequency, 8, EnterpriseNumber}, Field_Mode}
+		spotter        = newTestSpotter(t, SpotKind_CallsignFrequencyModeSourceFlowstart, "Dipole", WithFields(receiverFields, senderFields))
+		mode           = strings.Repeat("FT8", 100) // Needs the three-byte length prefix
+		spot           = NewSpot("N1CALL", "II00OG", 10368100000, -17, 2, mode, 1, 1670000000)
+	)
+
+	spotter.Feed(spot)
+	descriptors := IPFIXDescriptors(spotter)
+	message, err := NewDecoder().Decode(IPFIX(0, 0, descriptors, IPFIXRecords(spotter, len(descriptors)+HeaderLength)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(message.Receivers) != 1 || message.Receivers[0].Station != spotter.receiver || message.Receivers[0].AntennaInformation != spotter.antennaInformation || message.Receivers[0].DecoderSoftware != "" {
+		t.Errorf("unexpected receivers %+v", message.Receivers)
+	}
+
+	// Frequency is above 4 GHz, so it only survives in eight bytes
+	want := Spot{sender: Station{Callsign: "N1CALL"}, frequency: 10368100000, snr: -17, mode: mode, flowStartSeconds: 1670000000, receiver: spotter.receiver}
+	if len(message.Spots) != 1 || *message.Spots[0] != want {
+		t.Errorf("expected %+v, got %+v", want, message.Spots)
+	}
+}
+
+func TestTemplateValidation(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		receiverFields []Field
+		senderFields   []Field
+	}{
+		{"no sender callsign", nil, []Field{Field_Frequency}},
+		{"no receiver callsign", []Field{Field_ReceiverLocator}, nil},
+		{"receiver field in sender", nil, []Field{Field_SenderCallsign, Field_DecoderSoftware}},
+		{"repeated", nil, []Field{Field_SenderCallsign, Field_SenderCallsign}},
+		{"unknown", nil, []Field{Field_SenderCallsign, {42, 1, EnterpriseNumber}}},
+		{"text with fixed length", nil, []Field{{Element_SenderCallsign, 6, EnterpriseNumber}}},
+		{"number with variable length", nil, []Field{Field_SenderCallsign, {Element_Frequency, VariableLength, EnterpriseNumber}}},
+		{"number too long", nil, []Field{Field_SenderCallsign, {Element_Frequency, 16, EnterpriseNumber}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig()
+			WithFields(tt.receiverFields, tt.senderFields)(&config)
+			if err := config.Validate(); !errors.Is(err, ErrConfig) {
+				t.Errorf("expected %v, got %v", ErrConfig, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package wsjtx
+
+import (
+	"context"
+	"errors"
+	"github.com/kahara/go-pskreporter-spot"
+	"github.com/rs/zerolog/log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAddress  = "127.0.0.1:2237" // Where WSJT-X sends its messages unless configured otherwise
+	MaxDatagramSize = 65535
+)
+
+// Listener turns WSJT-X decodes into spots, keeping track of each instance's dial frequency and mode
+type Listener struct {
+	feeder  spot.Feeder
+	mutex   sync.Mutex
+	clients map[string]*Status
+	now     func() time.Time
+}
+
+func NewListener(feeder spot.Feeder) *Listener {
+	return &Listener{
+		feeder:  feeder,
+		clients: make(map[string]*Status),
+		now:     time.Now,
+	}
+}
+
+// ListenAndServe receives WSJT-X's messages on a UDP address, such as DefaultAddress, until ctx is done
+func ListenAndServe(ctx context.Context, address string, feeder spot.Feeder) error {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return err
+	}
+
+	return NewListener(feeder).Serve(ctx, conn)
+}
+
+// Serve handles datagrams from conn until ctx is done, closing conn when returning
+func (l *Listener) Serve(ctx context.Context, conn net.PacketConn) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		_ = conn.Close()
+	}()
+
+	buffer := make([]byte, MaxDatagramSize)
+	for {
+		n, remote, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if ctx.Err() != nil && errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		if err = l.Handle(buffer[:n]); err != nil {
+			log.Warn().Err(err).Str("remote", remote.String()).Msg("Could not handle WSJT-X message")
+		}
+	}
+}
+
+// Handle processes one datagram, feeding a spot if it is a decode that names its sender
+func (l *Listener) Handle(datagram []byte) error {
+	message, err := Parse(datagram)
+	if err != nil {
+		return err
+	}
+
+	var s *spot.Spot
+
+	l.mutex.Lock()
+	switch m := message.(type) {
+	case *Heartbeat:
+		log.Debug().Str("id", m.ID).Str("version", m.Version).Msg("WSJT-X heartbeat")
+	case *Status:
+		l.clients[m.ID] = m
+	case *Clear:
+		log.Debug().Str("id", m.ID).Msg("WSJT-X cleared decodes")
+	case *Decode:
+		s = l.spot(m)
+	}
+	l.mutex.Unlock()
+
+	// Feeding may block, so not while holding the lock
+	if s != nil {
+		l.feeder.Feed(s)
+	}
+
+	return nil
+}
+
+func (l *Listener) spot(decode *Decode) *spot.Spot {
+	// Replayed decodes have already been spotted, and ones from recordings aren't on the air
+	if !decode.New || decode.OffAir {
+		return nil
+	}
+
+	// Without a status there's no telling the frequency
+	status := l.clients[decode.ID]
+	if status == nil || status.DialFrequency == 0 {
+		log.Debug().Str("id", decode.ID).Msg("Decode before status, skipping")
+		return nil
+	}
+
+	callsign, grid, ok := ParseSender(decode.Message)
+	if !ok {
+		return nil
+	}
+
+	return spot.NewSpot(callsign, grid, status.DialFrequency+uint64(decode.DeltaFrequency), spot.ClampedSNR(int(decode.SNR)), 0, status.Mode, spot.InformationSource_AutomaticallyExtracted, l.flowStart(decode.Time))
+}
+
+// Decodes only carry the time of day, so put it on the most recent day that doesn't make it lie in the future
+func (l *Listener) flowStart(milliseconds uint32) uint32 {
+	var (
+		now       = l.now().UTC()
+		midnight  = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		flowStart = midnight.Add(time.Duration(milliseconds) * time.Millisecond)
+	)
+
+	// Allow for some clock skew around midnight
+	if flowStart.After(now.Add(time.Hour)) {
+		flowStart = flowStart.AddDate(0, 0, -1)
+	}
+
+	return uint32(flowStart.Unix())
+}
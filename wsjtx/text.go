@@ -0,0 +1,48 @@
+package wsjtx
+
+import (
+	"github.com/kahara/go-pskreporter-spot/callsign"
+	"regexp"
+	"strings"
+)
+
+var gridPattern = regexp.MustCompile(`^[A-R]{2}[0-9]{2}$`)
+
+// ParseSender picks the sender's callsign, and grid if there is one, out of a decoded message's text
+//
+// It understands CQ calls ("CQ K1ABC FN42", "CQ DX K1ABC FN42") and the standard exchange, where the sender comes
+// second ("W9XYZ K1ABC FN42", "W9XYZ K1ABC -15", "W9XYZ K1ABC RR73"). Free text and unresolved hashed callsigns
+// ("<...>") yield false.
+func ParseSender(text string) (call string, grid string, ok bool) {
+	fields := strings.Fields(strings.ToUpper(text))
+	if len(fields) < 2 {
+		return "", "", false
+	}
+
+	if fields[0] == "CQ" || fields[0] == "QRZ" {
+		fields = fields[1:]
+		// Directed CQ, such as "CQ DX" or "CQ POTA"
+		if len(fields) >= 2 && !callsign.Valid(fields[0]) {
+			fields = fields[1:]
+		}
+	} else {
+		fields = fields[1:]
+	}
+
+	// Also takes the angle brackets off callsigns WSJT-X could only partially recover
+	call, err := callsign.Normalize(fields[0])
+	if err != nil {
+		return "", "", false
+	}
+
+	if len(fields) >= 2 && isGrid(fields[1]) {
+		grid = fields[1]
+	}
+
+	return call, grid, true
+}
+
+// "RR73" looks like a grid, but is a sign-off
+func isGrid(grid string) bool {
+	return grid != "RR73" && gridPattern.MatchString(grid)
+}
@@ -0,0 +1,33 @@
+package wsjtx
+
+import "testing"
+
+func TestParseSender(t *testing.T) {
+	for _, tt := range []struct {
+		text     string
+		callsign string
+		grid     string
+		ok       bool
+	}{
+		{"CQ K1ABC FN42", "K1ABC", "FN42", true},
+		{"CQ DX K1ABC FN42", "K1ABC", "FN42", true},
+		{"CQ POTA K1ABC/P", "K1ABC/P", "", true},
+		{"cq k1abc fn42", "K1ABC", "FN42", true},
+		{"K1ABC W9XYZ EN37", "W9XYZ", "EN37", true},
+		{"K1ABC W9XYZ -15", "W9XYZ", "", true},
+		{"K1ABC W9XYZ R-15", "W9XYZ", "", true},
+		{"K1ABC W9XYZ RR73", "W9XYZ", "", true},
+		{"K1ABC <PJ4/W9XYZ> 73", "PJ4/W9XYZ", "", true},
+		{"K1ABC <...> RR73", "", "", false},
+		{"TNX BOB 73 GL", "", "", false},
+		{"CQ", "", "", false},
+		{"", "", "", false},
+	} {
+		t.Run(tt.text, func(t *testing.T) {
+			callsign, grid, ok := ParseSender(tt.text)
+			if callsign != tt.callsign || grid != tt.grid || ok != tt.ok {
+				t.Errorf("expected %q %q %v, got %q %q %v", tt.callsign, tt.grid, tt.ok, callsign, grid, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+// Package wsjtx implements the parts of WSJT-X's UDP protocol needed for turning decodes into spots
+//
+// See NetworkMessage.hpp in the WSJT-X sources for the full protocol.
+package wsjtx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	Magic  = 0xADBCCBDA
+	Schema = 2 // Oldest schema with everything needed here; newer ones only append fields
+)
+
+const (
+	MessageType_Heartbeat = 0
+	MessageType_Status    = 1
+	MessageType_Decode    = 2
+	MessageType_Clear     = 3
+)
+
+var (
+	ErrMagic     = errors.New("not a WSJT-X message")
+	ErrSchema    = errors.New("unsupported schema")
+	ErrTruncated = errors.New("message truncated")
+)
+
+// Header is common to all messages; ID identifies the WSJT-X instance that sent it
+type Header struct {
+	Schema uint32
+	Type   uint32
+	ID     string
+}
+
+type Heartbeat struct {
+	Header
+	MaxSchema uint32
+	Version   string
+	Revision  string
+}
+
+// Status is sent whenever WSJT-X's state changes, such as when the dial frequency or mode is changed
+type Status struct {
+	Header
+	DialFrequency uint64 // Hz
+	Mode          string
+	DXCall        string
+	Report        string
+	TxMode        string
+	TxEnabled     bool
+	Transmitting  bool
+	Decoding      bool
+	RxDF          uint32 // Hz
+	TxDF          uint32 // Hz
+	DECall        string
+	DEGrid        string
+	DXGrid        string
+}
+
+// Decode is one decoded message
+type Decode struct {
+	Header
+	New            bool   // False when replaying earlier decodes
+	Time           uint32 // Milliseconds since midnight UTC
+	SNR            int32
+	DeltaTime      float64 // Seconds
+	DeltaFrequency uint32  // Hz, the audio offset
+	Mode           string  // One-character code, such as "~" for FT8
+	Message        string
+	LowConfidence  bool
+	OffAir         bool // Decoded from a .WAV file
+}
+
+// Clear is sent when the band activity and/or Rx frequency windows are cleared
+type Clear struct {
+	Header
+	Window uint8 // 0 band activity, 1 Rx frequency, 2 both
+}
+
+// Parse decodes a datagram into one of *Heartbeat, *Status, *Decode or *Clear, or just a *Header for messages of other types
+func Parse(datagram []byte) (interface{}, error) {
+	r := reader{data: datagram}
+
+	if r.uint32() != Magic {
+		return nil, ErrMagic
+	}
+
+	header := Header{Schema: r.uint32(), Type: r.uint32()}
+	if r.err == nil && header.Schema < Schema {
+		return nil, fmt.Errorf("%w: %d", ErrSchema, header.Schema)
+	}
+	header.ID = r.utf8()
+
+	var message interface{}
+	switch header.Type {
+	case MessageType_Heartbeat:
+		message = &Heartbeat{
+			Header:    header,
+			MaxSchema: r.uint32(),
+			Version:   r.utf8(),
+			Revision:  r.utf8(),
+		}
+	case MessageType_Status:
+		status := &Status{
+			Header:        header,
+			DialFrequency: r.uint64(),
+			Mode:          r.utf8(),
+			DXCall:        r.utf8(),
+			Report:        r.utf8(),
+			TxMode:        r.utf8(),
+			TxEnabled:     r.bool(),
+			Transmitting:  r.bool(),
+			Decoding:      r.bool(),
+		}
+		// Older versions stop here
+		if r.left() > 0 {
+			status.RxDF = r.uint32()
+			status.TxDF = r.uint32()
+			status.DECall = r.utf8()
+			status.DEGrid = r.utf8()
+			status.DXGrid = r.utf8()
+		}
+		message = status
+	case MessageType_Decode:
+		decode := &Decode{
+			Header:         header,
+			New:            r.bool(),
+			Time:           r.uint32(),
+			SNR:            int32(r.uint32()),
+			DeltaTime:      math.Float64frombits(r.uint64()),
+			DeltaFrequency: r.uint32(),
+			Mode:           r.utf8(),
+			Message:        r.utf8(),
+		}
+		if r.left() > 0 {
+			decode.LowConfidence = r.bool()
+			decode.OffAir = r.bool()
+		}
+		message = decode
+	case MessageType_Clear:
+		clear := &Clear{Header: header}
+		if r.left() > 0 {
+			clear.Window = r.uint8()
+		}
+		message = clear
+	default:
+		message = &header
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return message, nil
+}
+
+// Reads QDataStream's big-endian encoding, remembering the first error
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) left() int {
+	return len(r.data)
+}
+
+func (r *reader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = fmt.Errorf("%w: wanted %d bytes, %d left", ErrTruncated, n, len(r.data))
+		r.data = nil
+		return nil
+	}
+
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) uint8() uint8 {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) bool() bool {
+	return r.uint8() != 0
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) uint64() uint64 {
+	if b := r.take(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// A QByteArray holding UTF-8; a length of 0xFFFFFFFF means null, which is treated as empty
+func (r *reader) utf8() string {
+	length := r.uint32()
+	if length == 0xFFFFFFFF {
+		return ""
+	}
+	return string(r.take(int(length)))
+}
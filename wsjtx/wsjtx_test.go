@@ -0,0 +1,151 @@
+package wsjtx
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"github.com/kahara/go-pskreporter-spot"
+	"github.com/kahara/go-pskreporter-spot/spottest"
+	"math"
+	"testing"
+	"time"
+)
+
+// Builds messages the way QDataStream does
+type writer []byte
+
+func newMessage(messageType uint32, id string) *writer {
+	w := &writer{}
+	w.uint32(Magic)
+	w.uint32(3)
+	w.uint32(messageType)
+	w.utf8(id)
+	return w
+}
+
+func (w *writer) bool(b bool) {
+	if b {
+		*w = append(*w, 1)
+	} else {
+		*w = append(*w, 0)
+	}
+}
+
+func (w *writer) uint32(v uint32) {
+	*w = binary.BigEndian.AppendUint32(*w, v)
+}
+
+func (w *writer) uint64(v uint64) {
+	*w = binary.BigEndian.AppendUint64(*w, v)
+}
+
+func (w *writer) utf8(s string) {
+	w.uint32(uint32(len(s)))
+	*w = append(*w, s...)
+}
+
+func status(id string, dialFrequency uint64, mode string) []byte {
+	w := newMessage(MessageType_Status, id)
+	w.uint64(dialFrequency)
+	w.utf8(mode)
+	w.utf8("")    // DX call
+	w.utf8("")    // Report
+	w.utf8(mode)  // Tx mode
+	w.bool(false) // Tx enabled
+	w.bool(false) // Transmitting
+	w.bool(true)  // Decoding
+	w.uint32(1500)
+	w.uint32(1500)
+	w.utf8("N0CALL")
+	w.utf8("JJ00")
+	w.utf8("")
+	return *w
+}
+
+func decode(id string, isNew bool, milliseconds uint32, snr int32, deltaFrequency uint32, text string) []byte {
+	w := newMessage(MessageType_Decode, id)
+	w.bool(isNew)
+	w.uint32(milliseconds)
+	w.uint32(uint32(snr))
+	w.uint64(math.Float64bits(0.2))
+	w.uint32(deltaFrequency)
+	w.utf8("~")
+	w.utf8(text)
+	w.bool(false)
+	w.bool(false)
+	return *w
+}
+
+func TestParse(t *testing.T) {
+	// A heartbeat laid out byte for byte like WSJT-X 2.6.1 sends it
+	heartbeat, _ := hex.DecodeString("adbccbda00000003000000000000000657534a542d580000000300000005322e362e310000000761353566343962")
+
+	message, err := Parse(heartbeat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, ok := message.(*Heartbeat); !ok || h.ID != "WSJT-X" || h.MaxSchema != 3 || h.Version != "2.6.1" || h.Revision != "a55f49b" {
+		t.Errorf("unexpected heartbeat %+v", message)
+	}
+
+	message, err = Parse(decode("WSJT-X", true, 43200000, -15, 1234, "CQ K1ABC FN42"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := message.(*Decode); !ok || !d.New || d.Time != 43200000 || d.SNR != -15 || d.DeltaTime != 0.2 || d.DeltaFrequency != 1234 || d.Mode != "~" || d.Message != "CQ K1ABC FN42" {
+		t.Errorf("unexpected decode %+v", message)
+	}
+
+	clear := newMessage(MessageType_Clear, "WSJT-X")
+	if message, err = Parse(*clear); err != nil {
+		t.Fatal(err)
+	} else if _, ok := message.(*Clear); !ok {
+		t.Errorf("unexpected clear %+v", message)
+	}
+
+	if _, err = Parse([]byte("hello, world")); !errors.Is(err, ErrMagic) {
+		t.Errorf("expected %v, got %v", ErrMagic, err)
+	}
+	if _, err = Parse(heartbeat[:len(heartbeat)-3]); !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected %v, got %v", ErrTruncated, err)
+	}
+}
+
+func TestListener(t *testing.T) {
+	var (
+		f        spottest.Feeder
+		listener = NewListener(&f)
+		now      = time.Date(2022, 12, 1, 0, 0, 30, 0, time.UTC)
+	)
+	listener.now = func() time.Time { return now }
+
+	for _, datagram := range [][]byte{
+		decode("WSJT-X", true, 15000, -3, 1000, "CQ N1CALL II00"), // No status yet
+		status("WSJT-X", 14074000, "FT8"),
+		decode("WSJT-X", true, 15000, -3, 1000, "CQ DX K1ABC FN42"),
+		decode("WSJT-X", false, 15000, -3, 1000, "CQ W1AW FN31"), // Replayed
+		decode("WSJT-X", true, 15000, -21, 2100, "K1ABC W9XYZ -15"),
+		decode("WSJT-X", true, 15000, -21, 2100, "TNX BOB 73 GL"),
+		status("JTDX", 7074000, "FT4"),
+		decode("JTDX", true, 86385000, 5, 500, "W9XYZ <OH2ABC/P> RR73"), // Just before midnight
+	} {
+		if err := listener.Handle(datagram); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []*spot.Spot{
+		spot.NewSpot("K1ABC", "FN42", 14075000, -3, 0, "FT8", 1, uint32(now.Unix())-15),
+		spot.NewSpot("W9XYZ", "", 14076100, -21, 0, "FT8", 1, uint32(now.Unix())-15),
+		spot.NewSpot("OH2ABC/P", "", 7074500, 5, 0, "FT4", 1, uint32(now.Unix())-45),
+	}
+	spots := f.Spots()
+	if len(spots) != len(want) {
+		t.Fatalf("expected %d spots, got %d", len(want), len(spots))
+	}
+	for i := range want {
+		if *spots[i] != *want[i] {
+			t.Errorf("spot %d: expected %+v, got %+v", i, *want[i], *spots[i])
+		}
+	}
+}